@@ -0,0 +1,82 @@
+package easycall
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	BALANCER_ACTIVE        = "active"
+	BALANCER_RANDOM        = "random"
+	BALANCER_HASH          = "hash"
+	BALANCER_ROUND_ROBIN   = "round_robin"
+	BALANCER_RANDOM_WEIGHT = "random_weight"
+	BALANCER_LATENCY       = "latency"
+	BALANCER_SMOOTH_WEIGHT = "smooth_weight"
+)
+
+//Balancer picks a node for every request of a service
+type Balancer interface {
+	//called with all nodes of the service every time they change
+	Update(nodeList []*Node)
+	//pick a node for the request,nodeList are the candidates of this request,
+	//they are the nodes given to Update or a subset of them
+	Pick(nodeList []*Node, head *EasyHead) (*Node, error)
+	//report the result of a request sent to node,err is nil when it succeeded
+	Report(node *Node, spend time.Duration, err error)
+}
+
+//BalancerFactory creates a new balancer for every service client
+type BalancerFactory func() Balancer
+
+var balancerFactories = map[string]BalancerFactory{
+	BALANCER_ACTIVE:        func() Balancer { return &activeBalancer{} },
+	BALANCER_RANDOM:        func() Balancer { return &randomBalancer{} },
+	BALANCER_HASH:          func() Balancer { return newHashBalancer() },
+	BALANCER_ROUND_ROBIN:   func() Balancer { return &roundRobinBalancer{} },
+	BALANCER_RANDOM_WEIGHT: func() Balancer { return &randomWeightBalancer{} },
+	BALANCER_LATENCY:       func() Balancer { return newLatencyBalancer() },
+	BALANCER_SMOOTH_WEIGHT: func() Balancer { return newSmoothWeightBalancer() },
+}
+
+var balancerMutex sync.RWMutex
+
+//register a balancer factory by name,a registered name is replaced
+func RegisterBalancer(name string, factory BalancerFactory) {
+	balancerMutex.Lock()
+	balancerFactories[name] = factory
+	balancerMutex.Unlock()
+}
+
+//create a balancer registered by name
+func NewBalancer(name string) (Balancer, error) {
+	balancerMutex.RLock()
+	factory := balancerFactories[name]
+	balancerMutex.RUnlock()
+	if factory == nil {
+		return nil, errors.New("balancer " + name + " not found")
+	}
+	return factory(), nil
+}
+
+//get the balancer name of LB_* loadBalanceType
+func GetBalancerName(loadBalanceType int) string {
+	switch loadBalanceType {
+	case LB_ACTIVE:
+		return BALANCER_ACTIVE
+	case LB_RANDOM:
+		return BALANCER_RANDOM
+	case LB_HASH:
+		return BALANCER_HASH
+	case LB_ROUND_ROBIN:
+		return BALANCER_ROUND_ROBIN
+	case LB_RANDOM_WEIGHT:
+		return BALANCER_RANDOM_WEIGHT
+	case LB_LATENCY:
+		return BALANCER_LATENCY
+	case LB_SMOOTH_WEIGHT:
+		return BALANCER_SMOOTH_WEIGHT
+	}
+	return ""
+}
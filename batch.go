@@ -0,0 +1,85 @@
+package easycall
+
+import (
+	"time"
+)
+
+const (
+	BATCH_BEST_EFFORT    = 0 //wait for every call,errors are kept in each call
+	BATCH_ALL_OR_NOTHING = 1 //the batch fails on the first failed call
+)
+
+//BatchCall is a call of EasyClient.Batch,Err is set once the batch returns
+type BatchCall struct {
+	Service string
+	Method  string
+	Req     interface{}
+	Resp    interface{} //response body is decoded into it
+	Err     error
+}
+
+func NewBatchCall(service string, method string, req interface{}, resp interface{}) *BatchCall {
+	return &BatchCall{Service: service, Method: method, Req: req, Resp: resp}
+}
+
+type batchResult struct {
+	index   int
+	respPkg *EasyPackage
+	err     error
+}
+
+//run calls concurrently and wait until all of them complete or timeout,
+//calls not completed before timeout fail with ERROR_TIME_OUT
+
+//calls calls to run
+//timeout overall deadline of the batch
+//policy BATCH_BEST_EFFORT or BATCH_ALL_OR_NOTHING,for BATCH_ALL_OR_NOTHING the first error is returned and set to calls not completed
+func (ec *EasyClient) Batch(calls []*BatchCall, timeout time.Duration, policy int) error {
+
+	deadline := time.Now().Add(timeout)
+	resultChan := make(chan *batchResult, len(calls))
+	for i, call := range calls {
+		go func(i int, call *BatchCall) {
+			defer PanicHandler()
+			head := NewEasyHead().SetService(call.Service).SetMethod(call.Method)
+			respPkg, err := ec.RequestWithHead(FORMAT_MSGPACK, head, call.Req, time.Until(deadline))
+			if err == nil {
+				err = getPkgError(respPkg)
+			}
+			resultChan <- &batchResult{i, respPkg, err}
+		}(i, call)
+	}
+
+	done := make([]bool, len(calls))
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	var batchErr error
+	for pending := len(calls); pending > 0 && batchErr == nil; pending-- {
+		select {
+		case result := <-resultChan:
+			call := calls[result.index]
+			done[result.index] = true
+			call.Err = result.err
+			if call.Err == nil && call.Resp != nil {
+				call.Err = result.respPkg.DecodeBody(call.Resp)
+			}
+			if call.Err != nil && policy == BATCH_ALL_OR_NOTHING {
+				batchErr = call.Err
+			}
+		case <-timer.C:
+			batchErr = NewSystemError(ERROR_TIME_OUT, "batch time out")
+		}
+	}
+
+	//results of calls not completed are dropped
+	for i, call := range calls {
+		if !done[i] {
+			call.Err = batchErr
+		}
+	}
+	if policy == BATCH_ALL_OR_NOTHING {
+		return batchErr
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package easycall
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBatch(t *testing.T) {
+
+	fast := startTestServices(t, 0)
+	slow := startTestServices(t, time.Millisecond*500)
+	client := NewStaticEasyClient(map[string][]*Node{"fast": fast, "slow": slow}, 10, LB_RANDOM)
+
+	fastResp := make(map[string]interface{})
+	slowResp := make(map[string]interface{})
+	calls := []*BatchCall{
+		NewBatchCall("fast", "GetProfile", map[string]interface{}{}, &fastResp),
+		NewBatchCall("slow", "GetProfile", map[string]interface{}{}, &slowResp),
+		NewBatchCall("fast", "NotFound", map[string]interface{}{}, nil),
+	}
+
+	startTime := time.Now()
+	err := client.Batch(calls, time.Millisecond*100, BATCH_BEST_EFFORT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(startTime) > time.Millisecond*300 {
+		t.Fatal("batch exceeds deadline")
+	}
+	if calls[0].Err != nil || respPort(fastResp) != fast[0].Port {
+		t.Fatalf("unexpected fast call:%v,%v", calls[0].Err, fastResp)
+	}
+	if sysErr, ok := calls[1].Err.(*SystemError); !ok || sysErr.GetRet() != ERROR_TIME_OUT {
+		t.Fatalf("unexpected slow call error:%v", calls[1].Err)
+	}
+	if sysErr, ok := calls[2].Err.(*SystemError); !ok || sysErr.GetRet() != ERROR_METHOD_NOT_FOUND {
+		t.Fatalf("unexpected not found call error:%v", calls[2].Err)
+	}
+
+	calls = []*BatchCall{
+		NewBatchCall("fast", "NotFound", map[string]interface{}{}, nil),
+		NewBatchCall("slow", "GetProfile", map[string]interface{}{}, nil),
+	}
+	startTime = time.Now()
+	err = client.Batch(calls, time.Second, BATCH_ALL_OR_NOTHING)
+	if err == nil || time.Since(startTime) > time.Millisecond*300 {
+		t.Fatalf("batch not failed fast,err=%v", err)
+	}
+	if calls[1].Err != err {
+		t.Fatalf("unexpected aborted call error:%v", calls[1].Err)
+	}
+}
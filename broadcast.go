@@ -0,0 +1,78 @@
+package easycall
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	BROADCAST_CONCURRENCY = 10
+)
+
+//BroadcastResult of a node
+type BroadcastResult struct {
+	Node *Node
+	Resp *EasyPackage //nil when Err is a system error before response
+	Err  error
+}
+
+//send the request to every node of the service and wait for all of them,
+//at most concurrency requests are in flight,see WithBroadcastConcurrency,
+//every request runs through interceptors and bulkhead with its node as target
+
+//method service method
+//body request body
+//timeout request timeout of every node
+//opts call options like WithFormat,WithMeta,WithTimeout
+func (ec *ServiceClient) Broadcast(method string, body interface{}, timeout time.Duration, opts ...CallOption) ([]*BroadcastResult, error) {
+	co := newCallOptions(ec.serviceName, method, timeout, opts)
+	return ec.BroadcastWithHead(co.format, co.head, body, co.timeout)
+}
+
+//format serialize format type json/msgpack
+//head request head,it is copied for every node
+//body request body
+//timeout request timeout of every node
+func (ec *ServiceClient) BroadcastWithHead(format byte, head *EasyHead, body interface{}, timeout time.Duration) ([]*BroadcastResult, error) {
+
+	nodeList, err := ec.getNodes(head)
+	if err != nil {
+		return nil, err
+	}
+
+	concurrency := ec.broadcastConcurrency
+	if concurrency <= 0 {
+		concurrency = BROADCAST_CONCURRENCY
+	}
+
+	results := make([]*BroadcastResult, len(nodeList))
+	limiter := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	wg.Add(len(nodeList))
+	for i, node := range nodeList {
+		limiter <- struct{}{}
+		go func(i int, node *Node) {
+			defer func() {
+				<-limiter
+				wg.Done()
+			}()
+			inv := &Invocation{format: format, head: copyHead(head), body: body, timeout: timeout, target: node}
+			err := ec.intercept(inv)
+			results[i] = &BroadcastResult{Node: node, Resp: inv.resp, Err: err}
+		}(i, node)
+	}
+	wg.Wait()
+	return results, nil
+}
+
+//interceptors of every node may change head meta,so meta is copied too
+func copyHead(head *EasyHead) *EasyHead {
+	h := *head
+	if head.Meta != nil {
+		h.Meta = make(map[string]string, len(head.Meta))
+		for k, v := range head.Meta {
+			h.Meta[k] = v
+		}
+	}
+	return &h
+}
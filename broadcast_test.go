@@ -0,0 +1,62 @@
+package easycall
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBroadcast(t *testing.T) {
+
+	nodeList := startTestServices(t, 0, time.Millisecond*10)
+	nodeList = append(nodeList, &Node{Ip: "127.0.0.1", Port: newClosedPorts(t, 1)[0], Weight: 100})
+	client := NewStaticServiceClient("profile", nodeList, 10, LB_RANDOM, WithBroadcastConcurrency(2))
+
+	results, err := client.Broadcast("GetProfile", map[string]interface{}{}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("expect 3 results,got %d", len(results))
+	}
+	for i, result := range results {
+		if result.Node.Port != nodeList[i].Port {
+			t.Fatalf("result %d of unexpected node %v", i, result.Node)
+		}
+		if i < 2 && result.Err != nil {
+			t.Fatal(result.Err)
+		}
+	}
+	if sysErr, ok := results[2].Err.(*SystemError); !ok || sysErr.GetRet() != ERROR_CONNECTION_LOST {
+		t.Fatalf("unexpected error:%v", results[2].Err)
+	}
+}
+
+func TestBroadcastInterceptor(t *testing.T) {
+
+	nodeList := startTestServices(t, 0, 0)
+	client := NewStaticServiceClient("profile", nodeList, 10, LB_RANDOM)
+	targets := make(chan *Node, len(nodeList))
+	client.AddInterceptor(func(inv *Invocation, next *InterceptorInfo) error {
+		targets <- inv.GetTarget()
+		inv.GetHead().SetToken("token-1").SetMeta("node", inv.GetTarget().GetAddr())
+		return next.Interceptor(inv, next.Next)
+	})
+
+	results, err := client.Broadcast("EchoHead", map[string]interface{}{}, time.Second, WithMeta("appId", "app1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, result := range results {
+		head := &EasyHead{}
+		if result.Err != nil {
+			t.Fatal(result.Err)
+		}
+		result.Resp.DecodeBody(head)
+		if head.GetToken() != "token-1" || head.GetMeta("node") != result.Node.GetAddr() || head.GetMeta("appId") != "app1" || result.Node.Port != nodeList[i].Port {
+			t.Fatalf("broadcast to %v not intercepted,head %v", result.Node, head)
+		}
+	}
+	if len(targets) != 2 || (<-targets) == nil {
+		t.Fatal("interceptor not called with target node")
+	}
+}
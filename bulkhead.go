@@ -0,0 +1,112 @@
+package easycall
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	BH_MAX_CONCURRENT = 100
+	BH_MAX_QUEUE      = 0
+	BH_WAIT_TIME      = 0
+)
+
+//Bulkhead limits concurrent calls to a dependency,calls beyond MaxConcurrent wait in a queue
+//of MaxQueue for WaitTime at most,calls rejected fail fast with ERROR_BULKHEAD_FULL
+type Bulkhead struct {
+	name     string
+	slots    chan struct{}
+	maxQueue int32
+	waitTime time.Duration
+	waiting  int32
+}
+
+//name bulkhead name
+//maxConcurrent max concurrent calls
+//maxQueue max calls waiting for a slot,0 means no queue
+//waitTime max time waiting in queue
+func NewBulkhead(name string, maxConcurrent int, maxQueue int, waitTime time.Duration) *Bulkhead {
+	if maxConcurrent <= 0 {
+		maxConcurrent = BH_MAX_CONCURRENT
+	}
+	return &Bulkhead{name: name, slots: make(chan struct{}, maxConcurrent), maxQueue: int32(maxQueue), waitTime: waitTime}
+}
+
+func (bh *Bulkhead) GetName() string {
+	return bh.name
+}
+
+//calls running
+func (bh *Bulkhead) GetActive() int {
+	return len(bh.slots)
+}
+
+//calls waiting in queue
+func (bh *Bulkhead) GetWaiting() int {
+	return int(atomic.LoadInt32(&bh.waiting))
+}
+
+//acquire a slot,false if rejected
+func (bh *Bulkhead) acquire() bool {
+
+	select {
+	case bh.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	if atomic.AddInt32(&bh.waiting, 1) > bh.maxQueue || bh.waitTime <= 0 {
+		atomic.AddInt32(&bh.waiting, -1)
+		return false
+	}
+	defer atomic.AddInt32(&bh.waiting, -1)
+
+	timer := time.NewTimer(bh.waitTime)
+	defer timer.Stop()
+	select {
+	case bh.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+func (bh *Bulkhead) release() {
+	<-bh.slots
+}
+
+//call run if a slot is acquired,otherwise ERROR_BULKHEAD_FULL error is returned
+func (bh *Bulkhead) Call(run func() error) error {
+	if !bh.acquire() {
+		return NewSystemError(ERROR_BULKHEAD_FULL, "bulkhead "+bh.name+" is full")
+	}
+	defer bh.release()
+	return run()
+}
+
+var bhBulkheads = make(map[string]*Bulkhead)
+var bhMutex sync.Mutex
+
+//configure bulkhead bhName for BhCall,calls running on the old bulkhead are not counted by the new one
+
+//maxConcurrent max concurrent calls
+//maxQueue max calls waiting for a slot,0 means no queue
+//waitTime max time waiting in queue
+func BhConfigure(bhName string, maxConcurrent int, maxQueue int, waitTime time.Duration) {
+	bhMutex.Lock()
+	bhBulkheads[bhName] = NewBulkhead(bhName, maxConcurrent, maxQueue, waitTime)
+	bhMutex.Unlock()
+}
+
+//call run through bulkhead bhName,bulkhead is created with default settings if not configured
+func BhCall(bhName string, run runFunc) error {
+	bhMutex.Lock()
+	bh := bhBulkheads[bhName]
+	if bh == nil {
+		bh = NewBulkhead(bhName, BH_MAX_CONCURRENT, BH_MAX_QUEUE, BH_WAIT_TIME)
+		bhBulkheads[bhName] = bh
+	}
+	bhMutex.Unlock()
+	return bh.Call(run)
+}
@@ -0,0 +1,62 @@
+package easycall
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBulkhead(t *testing.T) {
+
+	bh := NewBulkhead("test", 2, 1, time.Millisecond*30)
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bh.Call(func() error {
+				<-release
+				return nil
+			})
+		}()
+	}
+	time.Sleep(time.Millisecond * 10)
+	if bh.GetActive() != 2 {
+		t.Fatalf("expect 2 active calls,got %d", bh.GetActive())
+	}
+
+	//one call waits in queue,the other is rejected at once
+	queued := make(chan error, 1)
+	go func() {
+		queued <- bh.Call(func() error { return nil })
+	}()
+	time.Sleep(time.Millisecond * 5)
+	startTime := time.Now()
+	err := bh.Call(func() error { return nil })
+	if sysErr, ok := err.(*SystemError); !ok || sysErr.GetRet() != ERROR_BULKHEAD_FULL || time.Since(startTime) > time.Millisecond*10 {
+		t.Fatalf("call not rejected fast,err=%v", err)
+	}
+	if err := <-queued; err == nil {
+		t.Fatal("queued call not rejected after wait time")
+	}
+
+	close(release)
+	wg.Wait()
+	if err := bh.Call(func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientBulkhead(t *testing.T) {
+
+	nodeList := startTestServices(t, time.Millisecond*50)
+	client := NewStaticServiceClient("profile", nodeList, 10, LB_RANDOM, WithBulkhead(1, 0, 0))
+
+	go client.Request("GetProfile", map[string]interface{}{}, nil, time.Second)
+	time.Sleep(time.Millisecond * 10)
+	err := client.Request("GetProfile", map[string]interface{}{}, nil, time.Second)
+	if sysErr, ok := err.(*SystemError); !ok || sysErr.GetRet() != ERROR_BULKHEAD_FULL {
+		t.Fatalf("request not rejected by bulkhead,err=%v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package easycall
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	META_NO_CACHE = "noCache" //head meta to bypass response cache,the fresh response is still cached
+)
+
+//CacheStats of a method
+type CacheStats struct {
+	Hits    int64
+	Misses  int64
+	Entries int
+}
+
+type cacheEntry struct {
+	key     string
+	respPkg *EasyPackage
+	expire  time.Time
+}
+
+//lru cache of a method
+type methodCache struct {
+	ttl        time.Duration
+	maxEntries int
+	entries    map[string]*list.Element
+	lru        *list.List
+	hits       int64
+	misses     int64
+}
+
+//ResponseCache caches successful responses of read-mostly methods,requests are keyed by their encoded body,
+//add it to a client by AddInterceptor(cache.Intercept)
+type ResponseCache struct {
+	mutex   *sync.Mutex
+	methods map[string]*methodCache
+}
+
+func NewResponseCache() *ResponseCache {
+	return &ResponseCache{mutex: &sync.Mutex{}, methods: make(map[string]*methodCache, 0)}
+}
+
+//method service method to cache
+//ttl time to live of a response
+//maxEntries max responses kept,least recently used ones are evicted
+func (rc *ResponseCache) SetMethod(method string, ttl time.Duration, maxEntries int) *ResponseCache {
+	rc.mutex.Lock()
+	rc.methods[method] = &methodCache{ttl: ttl, maxEntries: maxEntries, entries: make(map[string]*list.Element, 0), lru: list.New()}
+	rc.mutex.Unlock()
+	return rc
+}
+
+//InterceptorFunc serving cached responses,node of the invocation is nil on cache hit,
+//only responses from network are cached,fallback responses and requests to a target node are not
+func (rc *ResponseCache) Intercept(inv *Invocation, next *InterceptorInfo) error {
+
+	head := inv.GetHead()
+	rc.mutex.Lock()
+	mc := rc.methods[head.GetMethod()]
+	rc.mutex.Unlock()
+	if mc == nil || inv.GetTarget() != nil {
+		return next.Interceptor(inv, next.Next)
+	}
+	key, ok := requestKey(inv.GetFormat(), head, inv.GetBody())
+	if !ok {
+		return next.Interceptor(inv, next.Next)
+	}
+
+	if head.GetMeta(META_NO_CACHE) == "" {
+		if respPkg := rc.get(mc, key); respPkg != nil {
+			atomic.AddInt64(&mc.hits, 1)
+			inv.node = nil
+			inv.resp = respPkg
+			return nil
+		}
+	}
+	atomic.AddInt64(&mc.misses, 1)
+
+	err := next.Interceptor(inv, next.Next)
+	if err == nil && inv.GetResp() != nil && inv.GetNode() != nil {
+		rc.put(mc, key, inv.GetResp())
+	}
+	return err
+}
+
+func (rc *ResponseCache) get(mc *methodCache, key string) *EasyPackage {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	elem := mc.entries[key]
+	if elem == nil {
+		return nil
+	}
+	entry := elem.Value.(*cacheEntry)
+	if time.Now().After(entry.expire) {
+		mc.lru.Remove(elem)
+		delete(mc.entries, key)
+		return nil
+	}
+	mc.lru.MoveToFront(elem)
+	return entry.respPkg
+}
+
+func (rc *ResponseCache) put(mc *methodCache, key string, respPkg *EasyPackage) {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	entry := &cacheEntry{key, respPkg, time.Now().Add(mc.ttl)}
+	if elem := mc.entries[key]; elem != nil {
+		elem.Value = entry
+		mc.lru.MoveToFront(elem)
+		return
+	}
+	mc.entries[key] = mc.lru.PushFront(entry)
+	for mc.maxEntries > 0 && mc.lru.Len() > mc.maxEntries {
+		oldest := mc.lru.Back()
+		mc.lru.Remove(oldest)
+		delete(mc.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+//remove all cached responses of method
+func (rc *ResponseCache) Invalidate(method string) {
+	rc.mutex.Lock()
+	if mc := rc.methods[method]; mc != nil {
+		mc.entries = make(map[string]*list.Element, 0)
+		mc.lru.Init()
+	}
+	rc.mutex.Unlock()
+}
+
+func (rc *ResponseCache) GetStats(method string) CacheStats {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	mc := rc.methods[method]
+	if mc == nil {
+		return CacheStats{}
+	}
+	return CacheStats{atomic.LoadInt64(&mc.hits), atomic.LoadInt64(&mc.misses), mc.lru.Len()}
+}
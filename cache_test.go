@@ -0,0 +1,87 @@
+package easycall
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestResponseCache(t *testing.T) {
+
+	service := &countService{}
+	port := newClosedPorts(t, 1)[0]
+	err := (&Server{}).CreateServer(port, NewServiceHandler(service, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewStaticServiceClient("profile", []*Node{{Ip: "127.0.0.1", Port: port, Weight: 100}}, 10, LB_RANDOM)
+	cache := NewResponseCache().SetMethod("GetProfile", time.Millisecond*100, 1)
+	client.AddInterceptor(cache.Intercept)
+
+	request := func(id int, opts ...CallOption) {
+		resp := make(map[string]interface{})
+		err := client.Request("GetProfile", map[string]interface{}{"id": id}, &resp, time.Second, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	request(1)
+	request(1)
+	request(1, WithNoCache())
+	if atomic.LoadInt32(&service.count) != 2 {
+		t.Fatalf("expect 2 network calls,got %d", service.count)
+	}
+
+	//evicted by max entries
+	request(2)
+	request(1)
+	if atomic.LoadInt32(&service.count) != 4 {
+		t.Fatalf("expect 4 network calls,got %d", service.count)
+	}
+
+	//expired
+	time.Sleep(time.Millisecond * 150)
+	request(1)
+
+	//the same request sent as encoded body data shares the entry
+	bodyData, err := NewPackageWithBody(FORMAT_MSGPACK, nil, map[string]interface{}{"id": 1}).EncodeBody()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := make(map[string]interface{})
+	err = client.Request("GetProfile", bodyData, &resp, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := cache.GetStats("GetProfile")
+	if stats.Hits != 2 || stats.Misses != 5 || stats.Entries != 1 {
+		t.Fatalf("unexpected stats:%v", stats)
+	}
+}
+
+func TestResponseCacheSkipFallback(t *testing.T) {
+
+	client := NewStaticServiceClient("profile", nil, 10, LB_RANDOM)
+	cache := NewResponseCache().SetMethod("GetProfile", time.Second, 10)
+	client.AddInterceptor(cache.Intercept)
+	fallbacks := 0
+	client.AddInterceptor(func(inv *Invocation, next *InterceptorInfo) error {
+		fallbacks++
+		pkgData, _ := NewPackageWithBody(inv.GetFormat(), inv.GetHead(), map[string]interface{}{}).EncodeWithBody()
+		respPkg, _ := DecodeWithBodyData(pkgData)
+		inv.SetResp(respPkg)
+		return nil
+	})
+
+	for i := 0; i < 2; i++ {
+		resp := make(map[string]interface{})
+		err := client.Request("GetProfile", map[string]interface{}{}, &resp, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fallbacks != 2 || cache.GetStats("GetProfile").Entries != 0 {
+		t.Fatalf("fallback response cached,fallbacks %d", fallbacks)
+	}
+}
@@ -0,0 +1,136 @@
+package easycall
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+//Call is the future of an asynchronous request,errors are mapped like the synchronous Request
+type Call struct {
+	Service   string
+	Method    string
+	Req       interface{}
+	Resp      interface{} //response body is decoded into it before the call is done
+	respPkg   *EasyPackage
+	err       error
+	done      chan struct{}
+	mutex     *sync.Mutex
+	callbacks []func(call *Call)
+}
+
+func newCall(service string, method string, req interface{}, resp interface{}) *Call {
+	return &Call{Service: service, Method: method, Req: req, Resp: resp, done: make(chan struct{}), mutex: &sync.Mutex{}}
+}
+
+//closed once the call completes
+func (c *Call) Done() <-chan struct{} {
+	return c.done
+}
+
+//wait until the call completes or ctx is done,it returns the error of the call or ctx
+func (c *Call) Wait(ctx context.Context) error {
+	select {
+	case <-c.done:
+		return c.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+//error of the completed call
+func (c *Call) GetError() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.err
+}
+
+//response package of the completed call,nil when request fails before response
+func (c *Call) GetRespPkg() *EasyPackage {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.respPkg
+}
+
+//callback is called once the call completes,it is called at once if the call is already done
+func (c *Call) OnComplete(callback func(call *Call)) *Call {
+	c.mutex.Lock()
+	select {
+	case <-c.done:
+		c.mutex.Unlock()
+		callback(c)
+		return c
+	default:
+	}
+	c.callbacks = append(c.callbacks, callback)
+	c.mutex.Unlock()
+	return c
+}
+
+func (c *Call) complete(respPkg *EasyPackage, err error) {
+
+	if err == nil && c.Resp != nil {
+		err = respPkg.DecodeBody(c.Resp)
+	}
+
+	c.mutex.Lock()
+	c.respPkg = respPkg
+	c.err = err
+	callbacks := c.callbacks
+	c.callbacks = nil
+	close(c.done)
+	c.mutex.Unlock()
+
+	for _, callback := range callbacks {
+		func() {
+			defer PanicHandler()
+			callback(c)
+		}()
+	}
+}
+
+//request asynchronously and return the future,interceptors and policies apply like Request
+
+//method service method
+//req request body
+//resp response body decoded into
+//timeout request timeout
+//opts call options like WithRouteKey,WithFormat,WithTimeout
+func (ec *ServiceClient) Go(method string, req interface{}, resp interface{}, timeout time.Duration, opts ...CallOption) *Call {
+	co := newCallOptions(ec.serviceName, method, timeout, opts)
+	return ec.GoWithHead(co.format, co.head, req, resp, co.timeout)
+}
+
+//format serialize format type json/msgpack
+//head request head
+//req request body
+//resp response body decoded into
+//timeout request timeout
+func (ec *ServiceClient) GoWithHead(format byte, head *EasyHead, req interface{}, resp interface{}, timeout time.Duration) *Call {
+	call := newCall(head.GetService(), head.GetMethod(), req, resp)
+	go func() {
+		defer PanicHandler()
+		respPkg, err := ec.invokeAsync(format, head, req, timeout)
+		call.complete(respPkg, err)
+	}()
+	return call
+}
+
+//serviceName microservice name
+//method service method
+//req request body
+//resp response body decoded into
+//timeout request timeout
+//opts call options like WithRouteKey,WithFormat,WithTimeout
+func (ec *EasyClient) Go(serviceName string, method string, req interface{}, resp interface{}, timeout time.Duration, opts ...CallOption) *Call {
+	return ec.getClient(serviceName).Go(method, req, resp, timeout, opts...)
+}
+
+//format serialize format type json/msgpack
+//head request head
+//req request body
+//resp response body decoded into
+//timeout request timeout
+func (ec *EasyClient) GoWithHead(format byte, head *EasyHead, req interface{}, resp interface{}, timeout time.Duration) *Call {
+	return ec.getClient(head.GetService()).GoWithHead(format, head, req, resp, timeout)
+}
@@ -0,0 +1,79 @@
+package easycall
+
+import "time"
+
+//CallOption configures a single request of the simple request APIs like Request and RequestAsync
+type CallOption func(co *callOptions)
+
+type callOptions struct {
+	format  byte
+	head    *EasyHead
+	timeout time.Duration
+}
+
+func newCallOptions(serviceName string, method string, timeout time.Duration, opts []CallOption) *callOptions {
+	co := &callOptions{format: FORMAT_MSGPACK, head: NewEasyHead().SetService(serviceName).SetMethod(method), timeout: timeout}
+	for _, opt := range opts {
+		opt(co)
+	}
+	return co
+}
+
+//format serialize format type json/msgpack,default msgpack
+func WithFormat(format byte) CallOption {
+	return func(co *callOptions) {
+		co.format = format
+	}
+}
+
+//routeKey routes requests with the same key to the same node
+func WithRouteKey(routeKey string) CallOption {
+	return func(co *callOptions) {
+		co.head.SetRouteKey(routeKey)
+	}
+}
+
+func WithUid(uid uint64) CallOption {
+	return func(co *callOptions) {
+		co.head.SetUid(uid)
+	}
+}
+
+func WithToken(token string) CallOption {
+	return func(co *callOptions) {
+		co.head.SetToken(token)
+	}
+}
+
+func WithTraceId(traceId string) CallOption {
+	return func(co *callOptions) {
+		co.head.SetTraceId(traceId)
+	}
+}
+
+func WithRequestIp(requestIp string) CallOption {
+	return func(co *callOptions) {
+		co.head.SetRequestIp(requestIp)
+	}
+}
+
+//user defined head field
+func WithMeta(key string, value string) CallOption {
+	return func(co *callOptions) {
+		co.head.SetMeta(key, value)
+	}
+}
+
+//timeout overrides the timeout argument
+func WithTimeout(timeout time.Duration) CallOption {
+	return func(co *callOptions) {
+		co.timeout = timeout
+	}
+}
+
+//bypass response cache,the fresh response is still cached
+func WithNoCache() CallOption {
+	return func(co *callOptions) {
+		co.head.SetMeta(META_NO_CACHE, "1")
+	}
+}
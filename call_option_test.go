@@ -0,0 +1,31 @@
+package easycall
+
+import (
+	"testing"
+	"time"
+)
+
+func (s *testService) EchoHead(req *Request, resp *Response) {
+	resp.SetBody(req.GetHead())
+}
+
+func TestCallOption(t *testing.T) {
+
+	nodeList := startTestServices(t, 0)
+	client := NewStaticEasyClient(map[string][]*Node{"profile": nodeList}, 10, LB_RANDOM)
+
+	resp := &EasyHead{}
+	err := client.Request("profile", "EchoHead", map[string]interface{}{}, resp, time.Second,
+		WithFormat(FORMAT_JSON), WithRouteKey("10001"), WithUid(10001), WithToken("token"), WithMeta("caller", "gateway"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.GetRouteKey() != "10001" || resp.GetUid() != 10001 || resp.GetToken() != "token" || resp.GetMeta("caller") != "gateway" {
+		t.Fatalf("unexpected head:%v", resp)
+	}
+
+	err = client.Request("profile", "EchoHead", map[string]interface{}{}, resp, 0, WithTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,55 @@
+package easycall
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCall(t *testing.T) {
+
+	nodeList := startTestServices(t, time.Millisecond*50)
+	client := NewStaticEasyClient(map[string][]*Node{"profile": nodeList}, 10, LB_RANDOM)
+
+	resp := make(map[string]interface{})
+	completed := make(chan error, 1)
+	call := client.Go("profile", "GetProfile", map[string]interface{}{}, &resp, time.Second).OnComplete(func(call *Call) {
+		completed <- call.GetError()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	if call.Wait(ctx) != context.DeadlineExceeded {
+		t.Fatal("wait should return when ctx is done")
+	}
+	cancel()
+
+	err := call.Wait(context.Background())
+	if err != nil || respPort(resp) != nodeList[0].Port {
+		t.Fatalf("unexpected call result:%v,%v", err, resp)
+	}
+	if <-completed != nil {
+		t.Fatal("callback not called")
+	}
+
+	call = client.Go("profile", "NotFound", map[string]interface{}{}, nil, time.Second)
+	<-call.Done()
+	if sysErr, ok := call.GetError().(*SystemError); !ok || sysErr.GetRet() != ERROR_METHOD_NOT_FOUND {
+		t.Fatalf("unexpected error:%v", call.GetError())
+	}
+	err = client.Request("profile", "NotFound", map[string]interface{}{}, nil, time.Second)
+	if sysErr, ok := err.(*SystemError); !ok || sysErr.GetRet() != ERROR_METHOD_NOT_FOUND {
+		t.Fatalf("unexpected request error:%v", err)
+	}
+
+	//a panicking request still completes the call
+	client.AddInterceptor(func(inv *Invocation, next *InterceptorInfo) error {
+		panic("interceptor panics")
+	})
+	call = client.Go("profile", "GetProfile", map[string]interface{}{}, nil, time.Second)
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err = call.Wait(ctx)
+	if sysErr, ok := err.(*SystemError); !ok || sysErr.GetRet() != ERROR_INTERNAL_ERROR {
+		t.Fatalf("unexpected panic error:%v", err)
+	}
+}
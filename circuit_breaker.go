@@ -1,173 +1,465 @@
 package easycall
 
 import (
-	"math/rand"
+	"sort"
 	"sync"
-	"sync/atomic"
+	"time"
 
 	"github.com/starjiang/elog"
 )
 
 const (
-	CB_FAIL_RATE    = 0.5
-	CB_LIMIT_RATE   = 0.2
-	CB_COUNT_BASE   = 10
-	CB_FAIL_TIME    = 30000
-	CB_LIMIT_TIME   = 30000
-	CB_RESET_TIME   = 60000
-	CB_STATUS_OPEN  = 1
-	CB_STATUS_CLOSE = 0
-	CB_STATUS_LIMIT = 2
+	CB_FAIL_RATE            = 0.5
+	CB_LIMIT_RATE           = 0.2
+	CB_COUNT_BASE           = 10
+	CB_FAIL_TIME            = 30000
+	CB_LIMIT_TIME           = 30000
+	CB_RESET_TIME           = 60000
+	CB_SLOW_CALL_RATE       = 0.8
+	CB_WINDOW_TIME          = 10000
+	CB_WINDOW_BUCKETS       = 10
+	CB_HALF_OPEN_PROBES     = 2
+	CB_STATUS_OPEN          = 1
+	CB_STATUS_CLOSE         = 0
+	CB_STATUS_LIMIT         = 2 //half open,probe requests are admitted
+	CB_CONSECUTIVE_DISABLED = 0
 )
 
 type runFunc func() error
 type failFunc func() error
 
-type CbInfo struct {
-	invokeCount            int64
-	failCount              int64
-	lastCircuitBreakerTime int64
-	lastLimitPassTime      int64
-	lastResetTime          int64
-	status                 int
-	failRate               float32
-	limitRate              float32
-	countBase              int
-	failTime               int64
-	limitTime              int64
-	resetTime              int64
+//BreakerOptions of CircuitBreaker,times are in milliseconds
+type BreakerOptions struct {
+	FailRate            float32              //open when failure rate within window exceeds it
+	MinRequests         int                  //min requests within window before rates apply
+	ConsecutiveFailures int                  //open after consecutive failures,0 disables it
+	SlowCallTime        int64                //calls slower than it are slow calls,0 disables slow call rate
+	SlowCallRate        float32              //open when slow call rate within window exceeds it
+	WindowTime          int64                //time of rolling window
+	WindowBuckets       int                  //buckets of rolling window
+	OpenTime            int64                //time kept open before half open
+	HalfOpenProbes      int                  //requests admitted when half open,breaker closes once all of them succeed
+	IsFailure           func(err error) bool //nil means every error is a failure
 }
 
-var cbInfos = make(map[string]*CbInfo)
-var cbMutexes = make(map[string]*sync.Mutex)
+func NewBreakerOptions() *BreakerOptions {
+	return &BreakerOptions{
+		FailRate:            CB_FAIL_RATE,
+		MinRequests:         CB_COUNT_BASE,
+		ConsecutiveFailures: CB_CONSECUTIVE_DISABLED,
+		SlowCallRate:        CB_SLOW_CALL_RATE,
+		WindowTime:          CB_WINDOW_TIME,
+		WindowBuckets:       CB_WINDOW_BUCKETS,
+		OpenTime:            CB_FAIL_TIME,
+		HalfOpenProbes:      CB_HALF_OPEN_PROBES,
+	}
+}
 
-var cbMutex sync.Mutex
+type cbBucket struct {
+	index    int64 //window bucket index,time / bucket time
+	total    int
+	failures int
+	slows    int
+}
 
-func CbConfigure(cbName string, failRate float32, limitRate float32, countBase int, failTime int64, limitTime int64, resetTime int64) {
+//CircuitBreaker counts calls in a rolling time bucketed window,it opens when failure rate,
+//slow call rate or consecutive failures exceed options,and half opens after OpenTime to admit probes
+type CircuitBreaker struct {
+	name        string
+	options     BreakerOptions
+	mutex       *sync.Mutex
+	status      int
+	buckets     []cbBucket
+	consecutive int
+	openTime    int64
+	probes      int    //probes admitted when half open
+	successes   int    //probes succeeded when half open
+	generation  uint64 //changes on every status change,so calls report to the status they passed
+	forced      bool   //status is kept by ForceOpen or ForceClose
+	listeners   []BreakerListener
+	changes     [][2]int //status changes to notify once mutex is released
+}
 
-	timeNow := GetTimeNow()
+//BreakerListener is called after the status of breaker name changes from one to another
+type BreakerListener func(name string, from int, to int)
 
-	var lock *sync.Mutex
+//BreakerStats of a breaker,counts are within rolling window
+type BreakerStats struct {
+	Name        string
+	Status      int
+	Forced      bool
+	Total       int
+	Failures    int
+	Slows       int
+	Consecutive int
+}
+
+var cbBreakers = make(map[string]*CircuitBreaker)
+var cbListeners = make([]BreakerListener, 0)
+var cbMutex sync.Mutex
+
+//listener is called on status changes of every breaker
+func AddBreakerListener(listener BreakerListener) {
 	cbMutex.Lock()
-	lock = cbMutexes[cbName]
-	if lock == nil {
-		lock = &sync.Mutex{}
-		cbMutexes[cbName] = lock
+	cbListeners = append(cbListeners, listener)
+	cbMutex.Unlock()
+}
+
+//stats of every registered breaker,breakers of clients are listed by ServiceClient.ListBreakers
+//and EasyClient.ListBreakers
+func ListBreakers() []BreakerStats {
+	cbMutex.Lock()
+	breakers := make([]*CircuitBreaker, 0, len(cbBreakers))
+	for _, cb := range cbBreakers {
+		breakers = append(breakers, cb)
 	}
+	cbMutex.Unlock()
 
-	info := cbInfos[cbName]
-	if info == nil {
-		info = &CbInfo{1, 0, 0, 0, timeNow, CB_STATUS_CLOSE, failRate, limitRate, countBase, failTime, limitTime, resetTime}
-		cbInfos[cbName] = info
+	statsList := make([]BreakerStats, 0, len(breakers))
+	for _, cb := range breakers {
+		statsList = append(statsList, cb.GetStats())
 	}
+	sort.Slice(statsList, func(i, j int) bool { return statsList[i].Name < statsList[j].Name })
+	return statsList
+}
+
+//create a breaker and register it by name,a breaker of the same name is replaced
 
+//name breaker name
+//options breaker options,nil means default options
+func NewCircuitBreaker(name string, options *BreakerOptions) *CircuitBreaker {
+	cb := newCircuitBreaker(name, options)
+	cbMutex.Lock()
+	cbBreakers[name] = cb
 	cbMutex.Unlock()
+	return cb
+}
 
-	lock.Lock()
-	info.failRate = failRate
-	info.limitRate = limitRate
-	info.countBase = countBase
-	info.failTime = failTime
-	info.limitTime = limitTime
-	info.resetTime = resetTime
-	lock.Unlock()
+func newCircuitBreaker(name string, options *BreakerOptions) *CircuitBreaker {
+	cb := &CircuitBreaker{name: name, mutex: &sync.Mutex{}, status: CB_STATUS_CLOSE}
+	cb.SetOptions(options)
+	return cb
+}
 
+//options new breaker options,nil means default options,window is cleared if WindowBuckets changes
+func (cb *CircuitBreaker) SetOptions(options *BreakerOptions) {
+	if options == nil {
+		options = NewBreakerOptions()
+	}
+	cb.mutex.Lock()
+	cb.options = *options
+	if cb.options.WindowBuckets <= 0 {
+		cb.options.WindowBuckets = CB_WINDOW_BUCKETS
+	}
+	if cb.options.HalfOpenProbes <= 0 {
+		cb.options.HalfOpenProbes = 1
+	}
+	if len(cb.buckets) != cb.options.WindowBuckets {
+		cb.buckets = make([]cbBucket, cb.options.WindowBuckets)
+	}
+	cb.mutex.Unlock()
 }
 
-func CbCall(cbName string, run runFunc, fail failFunc) error {
+//get the breaker registered by name,it is created with options if not found
+func getCircuitBreaker(name string, options *BreakerOptions) *CircuitBreaker {
+	cbMutex.Lock()
+	defer cbMutex.Unlock()
+	cb := cbBreakers[name]
+	if cb == nil {
+		cb = newCircuitBreaker(name, options)
+		cbBreakers[name] = cb
+	}
+	return cb
+}
+
+//get the breaker registered by name,nil if not found
+func GetCircuitBreaker(name string) *CircuitBreaker {
+	cbMutex.Lock()
+	defer cbMutex.Unlock()
+	return cbBreakers[name]
+}
+
+func (cb *CircuitBreaker) GetName() string {
+	return cb.name
+}
 
+//CB_STATUS_CLOSE,CB_STATUS_OPEN or CB_STATUS_LIMIT
+func (cb *CircuitBreaker) GetStatus() int {
+	cb.mutex.Lock()
+	defer cb.unlock()
+	cb.checkOpenTimeout(GetTimeNow())
+	return cb.status
+}
+
+func (cb *CircuitBreaker) GetStats() BreakerStats {
 	timeNow := GetTimeNow()
+	cb.mutex.Lock()
+	defer cb.unlock()
+	cb.checkOpenTimeout(timeNow)
+	total, failures, slows := cb.sum(timeNow)
+	return BreakerStats{cb.name, cb.status, cb.forced, total, failures, slows, cb.consecutive}
+}
 
-	var lock *sync.Mutex
-	cbMutex.Lock()
-	lock = cbMutexes[cbName]
-	if lock == nil {
-		lock = &sync.Mutex{}
-		cbMutexes[cbName] = lock
-	}
+//listener is called on status changes of this breaker
+func (cb *CircuitBreaker) AddListener(listener BreakerListener) {
+	cb.mutex.Lock()
+	cb.listeners = append(cb.listeners, listener)
+	cb.mutex.Unlock()
+}
 
-	info := cbInfos[cbName]
-	if info == nil {
-		info = &CbInfo{1, 0, 0, 0, timeNow, CB_STATUS_CLOSE, CB_FAIL_RATE, CB_LIMIT_RATE, CB_COUNT_BASE, CB_FAIL_TIME, CB_LIMIT_TIME, CB_RESET_TIME}
-		cbInfos[cbName] = info
+//keep breaker open until ForceClose or Reset
+func (cb *CircuitBreaker) ForceOpen() {
+	cb.force(CB_STATUS_OPEN)
+}
+
+//keep breaker closed until ForceOpen or Reset,calls are still counted
+func (cb *CircuitBreaker) ForceClose() {
+	cb.force(CB_STATUS_CLOSE)
+}
+
+//close breaker and clear window,status changes automatically again
+func (cb *CircuitBreaker) Reset() {
+	cb.mutex.Lock()
+	defer cb.unlock()
+	cb.forced = false
+	cb.setStatus(CB_STATUS_CLOSE, GetTimeNow())
+}
+
+func (cb *CircuitBreaker) force(status int) {
+	cb.mutex.Lock()
+	defer cb.unlock()
+	cb.forced = true
+	if cb.status != status {
+		cb.setStatus(status, GetTimeNow())
 	}
+	elog.Errorf("CircuitBreaker %s forced", cb.name)
+}
 
-	cbMutex.Unlock()
+//release mutex and notify listeners of status changes
+func (cb *CircuitBreaker) unlock() {
+	changes := cb.changes
+	cb.changes = nil
+	listeners := cb.listeners
+	cb.mutex.Unlock()
 
-	lock.Lock()
-
-	//熔断过期后，把熔断器状态设置为半开状
-	if info.status == CB_STATUS_OPEN && info.lastCircuitBreakerTime+info.failTime < timeNow {
-		info.status = CB_STATUS_LIMIT
-		info.failCount = 0
-		info.invokeCount = 1
-		info.lastLimitPassTime = timeNow
-		info.lastCircuitBreakerTime = 0
-		elog.Errorf("CircuitBreaker %s set status limit", cbName)
-	}
-
-	ptFlag := false
-	if info.status == CB_STATUS_OPEN {
-		ptFlag = false
-	} else if info.status == CB_STATUS_LIMIT {
-		//半开状态下，随机计算允许通过的请求
-		rand := rand.Float32()
-		if rand < info.limitRate {
-			ptFlag = true
+	if len(changes) == 0 {
+		return
+	}
+	all := make([]BreakerListener, 0)
+	all = append(all, listeners...)
+	cbMutex.Lock()
+	all = append(all, cbListeners...)
+	cbMutex.Unlock()
+	for _, change := range changes {
+		for _, listener := range all {
+			func() {
+				defer PanicHandler()
+				listener(cb.name, change[0], change[1])
+			}()
 		}
-	} else {
-		ptFlag = true
 	}
+}
 
-	if !ptFlag {
+//call run if breaker admits it,otherwise fail is called,
+//ERROR_CIRCUIT_OPEN error is returned if fail is nil
+func (cb *CircuitBreaker) Call(run func() error, fail func() error) error {
+
+	generation, ok := cb.allow()
+	if !ok {
 		if fail != nil {
-			lock.Unlock()
 			return fail()
 		}
-		lock.Unlock()
-		return nil
+		return NewSystemError(ERROR_CIRCUIT_OPEN, "circuit breaker "+cb.name+" is open")
 	}
 
-	//计算熔断阀值，超过阀值，熔断
-	f := float32(info.failCount) / float32(info.invokeCount)
+	startTime := time.Now()
+	var err error
+	panicked := true
+	//a panic of run is counted as a failure,so half open probes are always returned
+	defer func() {
+		if panicked {
+			err = NewSystemError(ERROR_INTERNAL_ERROR, "circuit breaker "+cb.name+" call panics")
+		}
+		cb.done(generation, err, time.Since(startTime))
+	}()
+	err = run()
+	panicked = false
+	return err
+}
 
-	if f > info.failRate && info.invokeCount > int64(info.countBase) {
-		info.status = CB_STATUS_OPEN
-		info.lastCircuitBreakerTime = timeNow
-		elog.Errorf("CircuitBreaker %s set status open", cbName)
-		if fail != nil {
-			lock.Unlock()
-			return fail()
+//must be called with mutex held
+func (cb *CircuitBreaker) checkOpenTimeout(timeNow int64) {
+	if cb.status == CB_STATUS_OPEN && !cb.forced && cb.openTime+cb.options.OpenTime <= timeNow {
+		cb.setStatus(CB_STATUS_LIMIT, timeNow)
+	}
+}
+
+//must be called with mutex held
+func (cb *CircuitBreaker) setStatus(status int, timeNow int64) {
+	if cb.status != status {
+		cb.changes = append(cb.changes, [2]int{cb.status, status})
+	}
+	cb.status = status
+	cb.generation++
+	cb.consecutive = 0
+	cb.probes = 0
+	cb.successes = 0
+	switch status {
+	case CB_STATUS_OPEN:
+		cb.openTime = timeNow
+		elog.Errorf("CircuitBreaker %s set status open", cb.name)
+	case CB_STATUS_LIMIT:
+		elog.Errorf("CircuitBreaker %s set status limit", cb.name)
+	case CB_STATUS_CLOSE:
+		for i := range cb.buckets {
+			cb.buckets[i] = cbBucket{}
 		}
-		lock.Unlock()
-		return nil
+		elog.Errorf("CircuitBreaker %s set status close", cb.name)
 	}
+}
 
-	//半开状态下，请求没超过阀值，关闭熔断器
-	if info.status == CB_STATUS_LIMIT && info.lastLimitPassTime+info.limitTime < timeNow {
-		info.status = CB_STATUS_CLOSE
-		info.invokeCount = 1
-		info.failCount = 0
-		info.lastLimitPassTime = 0
-		elog.Errorf("CircuitBreaker %s set status close", cbName)
+func (cb *CircuitBreaker) allow() (uint64, bool) {
+
+	cb.mutex.Lock()
+	defer cb.unlock()
+
+	cb.checkOpenTimeout(GetTimeNow())
+	switch cb.status {
+	case CB_STATUS_OPEN:
+		return 0, false
+	case CB_STATUS_LIMIT:
+		if cb.probes >= cb.options.HalfOpenProbes {
+			return 0, false
+		}
+		cb.probes++
 	}
+	return cb.generation, true
+}
 
-	//重置统计
-	if info.status == CB_STATUS_CLOSE && info.lastResetTime+info.resetTime < timeNow {
-		info.lastResetTime = timeNow
-		info.failCount = 0
-		info.invokeCount = 1
-		elog.Infof("CircuitBreaker %s reset", cbName)
+func (cb *CircuitBreaker) isFailure(err error) bool {
+	if cb.options.IsFailure != nil {
+		return cb.options.IsFailure(err)
 	}
+	return err != nil
+}
 
-	lock.Unlock()
+func (cb *CircuitBreaker) done(generation uint64, err error, spend time.Duration) {
 
-	atomic.AddInt64(&info.invokeCount, 1)
+	failed := cb.isFailure(err)
+	slow := cb.options.SlowCallTime > 0 && spend >= time.Duration(cb.options.SlowCallTime)*time.Millisecond
+	timeNow := GetTimeNow()
 
-	err := run()
+	cb.mutex.Lock()
+	defer cb.unlock()
 
-	if err != nil {
-		atomic.AddInt64(&info.failCount, 1)
+	//status changed while calling
+	if generation != cb.generation {
+		return
 	}
-	return err
+
+	if cb.status == CB_STATUS_LIMIT {
+		if failed || slow {
+			cb.setStatus(CB_STATUS_OPEN, timeNow)
+			return
+		}
+		cb.successes++
+		if cb.successes >= cb.options.HalfOpenProbes {
+			cb.setStatus(CB_STATUS_CLOSE, timeNow)
+		}
+		return
+	}
+
+	bucket := cb.bucket(timeNow)
+	bucket.total++
+	if failed {
+		bucket.failures++
+		cb.consecutive++
+	} else {
+		cb.consecutive = 0
+	}
+	if slow {
+		bucket.slows++
+	}
+	if cb.forced {
+		return
+	}
+
+	if cb.options.ConsecutiveFailures > 0 && cb.consecutive >= cb.options.ConsecutiveFailures {
+		cb.setStatus(CB_STATUS_OPEN, timeNow)
+		return
+	}
+	total, failures, slows := cb.sum(timeNow)
+	if total < cb.options.MinRequests {
+		return
+	}
+	if float32(failures)/float32(total) > cb.options.FailRate {
+		cb.setStatus(CB_STATUS_OPEN, timeNow)
+		return
+	}
+	if cb.options.SlowCallTime > 0 && float32(slows)/float32(total) > cb.options.SlowCallRate {
+		cb.setStatus(CB_STATUS_OPEN, timeNow)
+	}
+}
+
+func (cb *CircuitBreaker) bucketTime() int64 {
+	bucketTime := cb.options.WindowTime / int64(len(cb.buckets))
+	if bucketTime <= 0 {
+		return 1
+	}
+	return bucketTime
+}
+
+//bucket of timeNow,must be called with mutex held
+func (cb *CircuitBreaker) bucket(timeNow int64) *cbBucket {
+	index := timeNow / cb.bucketTime()
+	bucket := &cb.buckets[index%int64(len(cb.buckets))]
+	if bucket.index != index {
+		*bucket = cbBucket{index: index}
+	}
+	return bucket
+}
+
+//counts within window,must be called with mutex held
+func (cb *CircuitBreaker) sum(timeNow int64) (int, int, int) {
+	index := timeNow / cb.bucketTime()
+	total, failures, slows := 0, 0, 0
+	for _, bucket := range cb.buckets {
+		if bucket.index > index-int64(len(cb.buckets)) {
+			total += bucket.total
+			failures += bucket.failures
+			slows += bucket.slows
+		}
+	}
+	return total, failures, slows
+}
+
+//configure breaker cbName for CbCall,it keeps the compatible arguments
+
+//failRate open when failure rate exceeds it
+//limitRate limitRate*countBase probes are admitted when half open
+//countBase min requests before failure rate applies
+//failTime milliseconds kept open before half open
+//limitTime not used,half open breaker closes once probes succeed
+//resetTime milliseconds of rolling window
+func CbConfigure(cbName string, failRate float32, limitRate float32, countBase int, failTime int64, limitTime int64, resetTime int64) {
+
+	options := NewBreakerOptions()
+	options.FailRate = failRate
+	options.MinRequests = countBase
+	options.OpenTime = failTime
+	options.WindowTime = resetTime
+	options.HalfOpenProbes = int(limitRate * float32(countBase))
+	getCircuitBreaker(cbName, options).SetOptions(options)
+}
+
+//call run through breaker cbName,fail is called when breaker is open,
+//breaker is created with default options if not configured
+func CbCall(cbName string, run runFunc, fail failFunc) error {
+
+	if fail == nil {
+		fail = func() error {
+			return nil
+		}
+	}
+	return getCircuitBreaker(cbName, nil).Call(run, fail)
 }
@@ -0,0 +1,195 @@
+package easycall
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+var errTestCall = errors.New("call fail")
+
+func callBreaker(cb *CircuitBreaker, err error) error {
+	return cb.Call(func() error {
+		return err
+	}, nil)
+}
+
+func TestBreakerFailRate(t *testing.T) {
+
+	options := NewBreakerOptions()
+	options.MinRequests = 3
+	options.OpenTime = 50
+	options.HalfOpenProbes = 2
+	cb := NewCircuitBreaker("test.failRate", options)
+
+	callBreaker(cb, nil)
+	callBreaker(cb, errTestCall)
+	if cb.GetStatus() != CB_STATUS_CLOSE {
+		t.Fatal("breaker opened before min requests")
+	}
+	//rate includes the current call
+	callBreaker(cb, errTestCall)
+	if cb.GetStatus() != CB_STATUS_OPEN {
+		t.Fatal("breaker not opened")
+	}
+	if err, ok := callBreaker(cb, nil).(*SystemError); !ok || err.GetRet() != ERROR_CIRCUIT_OPEN {
+		t.Fatal("call not rejected by open breaker")
+	}
+
+	time.Sleep(time.Millisecond * 60)
+	if cb.GetStatus() != CB_STATUS_LIMIT {
+		t.Fatal("breaker not half open")
+	}
+	//only probes are admitted
+	probes := make(chan struct{})
+	admitted := 0
+	for i := 0; i < 2; i++ {
+		go cb.Call(func() error {
+			<-probes
+			return nil
+		}, nil)
+	}
+	time.Sleep(time.Millisecond * 10)
+	cb.Call(func() error {
+		admitted++
+		return nil
+	}, nil)
+	if admitted != 0 {
+		t.Fatal("more than probes admitted")
+	}
+	close(probes)
+	time.Sleep(time.Millisecond * 10)
+	if cb.GetStatus() != CB_STATUS_CLOSE {
+		t.Fatal("breaker not closed after probes succeed")
+	}
+}
+
+func TestBreakerConsecutiveAndSlow(t *testing.T) {
+
+	options := NewBreakerOptions()
+	options.ConsecutiveFailures = 3
+	options.MinRequests = 100
+	cb := NewCircuitBreaker("test.consecutive", options)
+	for i := 0; i < 3; i++ {
+		callBreaker(cb, errTestCall)
+	}
+	if cb.GetStatus() != CB_STATUS_OPEN {
+		t.Fatal("breaker not opened by consecutive failures")
+	}
+
+	options = NewBreakerOptions()
+	options.MinRequests = 2
+	options.SlowCallTime = 5
+	options.SlowCallRate = 0.5
+	cb = NewCircuitBreaker("test.slow", options)
+	for i := 0; i < 2; i++ {
+		cb.Call(func() error {
+			time.Sleep(time.Millisecond * 10)
+			return nil
+		}, nil)
+	}
+	if cb.GetStatus() != CB_STATUS_OPEN {
+		t.Fatal("breaker not opened by slow calls")
+	}
+}
+
+func TestCbCall(t *testing.T) {
+
+	CbConfigure("test.cbCall", 0.5, 0.2, 10, 30000, 30000, 60000)
+	failed := 0
+	for i := 0; i < 20; i++ {
+		CbCall("test.cbCall", func() error {
+			return errTestCall
+		}, func() error {
+			failed++
+			return nil
+		})
+	}
+	if failed == 0 {
+		t.Fatal("fail func not called")
+	}
+}
+
+func TestBreakerEvents(t *testing.T) {
+
+	options := NewBreakerOptions()
+	options.ConsecutiveFailures = 1
+	options.OpenTime = 20
+	options.HalfOpenProbes = 1
+	cb := NewCircuitBreaker("test.events", options)
+
+	changes := make([][2]int, 0)
+	cb.AddListener(func(name string, from int, to int) {
+		if name != "test.events" {
+			t.Errorf("unexpected breaker %s", name)
+		}
+		changes = append(changes, [2]int{from, to})
+	})
+
+	callBreaker(cb, errTestCall)
+	time.Sleep(time.Millisecond * 30)
+	callBreaker(cb, nil)
+	expect := [][2]int{{CB_STATUS_CLOSE, CB_STATUS_OPEN}, {CB_STATUS_OPEN, CB_STATUS_LIMIT}, {CB_STATUS_LIMIT, CB_STATUS_CLOSE}}
+	if len(changes) != len(expect) {
+		t.Fatalf("unexpected changes:%v", changes)
+	}
+	for i := range expect {
+		if changes[i] != expect[i] {
+			t.Fatalf("unexpected changes:%v", changes)
+		}
+	}
+
+	cb.ForceOpen()
+	time.Sleep(time.Millisecond * 30)
+	if cb.GetStatus() != CB_STATUS_OPEN {
+		t.Fatal("forced open breaker half opened")
+	}
+	cb.ForceClose()
+	callBreaker(cb, errTestCall)
+	found := false
+	for _, stats := range ListBreakers() {
+		if stats.Name == "test.events" {
+			found = true
+			if stats.Status != CB_STATUS_CLOSE || !stats.Forced || stats.Failures != 1 {
+				t.Fatalf("unexpected stats:%v", stats)
+			}
+		}
+	}
+	if !found {
+		t.Fatal("breaker not listed")
+	}
+	cb.Reset()
+	callBreaker(cb, errTestCall)
+	if cb.GetStatus() != CB_STATUS_OPEN {
+		t.Fatal("breaker not automatic after reset")
+	}
+}
+
+func TestBreakerProbePanic(t *testing.T) {
+
+	options := NewBreakerOptions()
+	options.ConsecutiveFailures = 1
+	options.OpenTime = 20
+	options.HalfOpenProbes = 1
+	cb := NewCircuitBreaker("test.probePanic", options)
+
+	callBreaker(cb, errTestCall)
+	time.Sleep(time.Millisecond * 30)
+	func() {
+		defer func() {
+			recover()
+		}()
+		cb.Call(func() error {
+			panic("probe panics")
+		}, nil)
+	}()
+	if cb.GetStatus() != CB_STATUS_OPEN {
+		t.Fatal("panic not counted as failure")
+	}
+
+	//the probe slot is returned,so the breaker can close again
+	time.Sleep(time.Millisecond * 30)
+	if err := callBreaker(cb, nil); err != nil || cb.GetStatus() != CB_STATUS_CLOSE {
+		t.Fatalf("breaker stuck after probe panic,err=%v,status=%d", err, cb.GetStatus())
+	}
+}
@@ -0,0 +1,241 @@
+package easycall
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//FallbackFunc returns the response body or error of a request rejected by an open circuit breaker
+type FallbackFunc func(head *EasyHead, body interface{}) (interface{}, error)
+
+//BreakerPolicy of circuit breakers in ServiceClient,system errors and timeouts are counted as failures,
+//it can be loaded by EasyConfig.GetConfig,see NewBreakerPolicyFromConfig
+type BreakerPolicy struct {
+	BreakerOptions
+	PerNode bool //break every node besides every service method
+}
+
+func NewBreakerPolicy() *BreakerPolicy {
+	return &BreakerPolicy{*NewBreakerOptions(), false}
+}
+
+//config easycall config
+//prefix config name prefix,e.g. "breaker." for breaker.failRate,breaker.perNode
+func NewBreakerPolicyFromConfig(config *EasyConfig, prefix string) *BreakerPolicy {
+	policy := NewBreakerPolicy()
+	config.GetConfig(prefix, policy)
+	return policy
+}
+
+//clientBreaker applies circuit breakers to requests of a ServiceClient,breakers belong to the client
+//and are not registered globally,so clients of the same service keep their own options
+type clientBreaker struct {
+	options   BreakerOptions
+	perNode   bool
+	mutex     *sync.Mutex
+	fallbacks map[string]FallbackFunc
+	breakers  map[string]*CircuitBreaker
+}
+
+func newClientBreaker(policy *BreakerPolicy) *clientBreaker {
+	cb := &clientBreaker{options: policy.BreakerOptions, perNode: policy.PerNode, mutex: &sync.Mutex{}, fallbacks: make(map[string]FallbackFunc, 0), breakers: make(map[string]*CircuitBreaker, 0)}
+	cb.options.IsFailure = isNodeFailure
+	return cb
+}
+
+//call run through circuit breaker cbName,it returns ERROR_CIRCUIT_OPEN error when breaker is open
+func (cb *clientBreaker) call(cbName string, run func() error) error {
+	cb.mutex.Lock()
+	breaker := cb.breakers[cbName]
+	if breaker == nil {
+		breaker = newCircuitBreaker(cbName, &cb.options)
+		cb.breakers[cbName] = breaker
+	}
+	cb.mutex.Unlock()
+	return breaker.Call(run, nil)
+}
+
+//skip nodes whose breaker of method is open when breaking every node,all nodes are kept if every one is open
+func (cb *clientBreaker) filter(nodeList []*Node, cbName string) []*Node {
+	if !cb.perNode {
+		return nodeList
+	}
+	cb.mutex.Lock()
+	breakers := make([]*CircuitBreaker, len(nodeList))
+	for i, node := range nodeList {
+		breakers[i] = cb.breakers[cbName+"@"+node.GetAddr()]
+	}
+	cb.mutex.Unlock()
+
+	available := make([]*Node, 0, len(nodeList))
+	for i, node := range nodeList {
+		if breakers[i] == nil || breakers[i].GetStatus() != CB_STATUS_OPEN {
+			available = append(available, node)
+		}
+	}
+	if len(available) == 0 {
+		return nodeList
+	}
+	return available
+}
+
+//drop breakers of nodes no longer alive
+func (cb *clientBreaker) update(nodeList []*Node) {
+	alive := make(map[string]bool, len(nodeList))
+	for _, node := range nodeList {
+		alive[node.GetAddr()] = true
+	}
+	cb.mutex.Lock()
+	for name := range cb.breakers {
+		if index := strings.LastIndex(name, "@"); index >= 0 && !alive[name[index+1:]] {
+			delete(cb.breakers, name)
+		}
+	}
+	cb.mutex.Unlock()
+}
+
+func (cb *clientBreaker) getFallback(method string) FallbackFunc {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	return cb.fallbacks[method]
+}
+
+//stats of breakers of this client,names are "service.method" or "service.method@ip:port"
+func (ec *ServiceClient) ListBreakers() []BreakerStats {
+	if ec.breaker == nil {
+		return nil
+	}
+	ec.breaker.mutex.Lock()
+	breakers := make([]*CircuitBreaker, 0, len(ec.breaker.breakers))
+	for _, breaker := range ec.breaker.breakers {
+		breakers = append(breakers, breaker)
+	}
+	ec.breaker.mutex.Unlock()
+
+	statsList := make([]BreakerStats, 0, len(breakers))
+	for _, breaker := range breakers {
+		statsList = append(statsList, breaker.GetStats())
+	}
+	sort.Slice(statsList, func(i, j int) bool { return statsList[i].Name < statsList[j].Name })
+	return statsList
+}
+
+//get breaker of this client by name,e.g. to force it open,nil if not found
+func (ec *ServiceClient) GetBreaker(name string) *CircuitBreaker {
+	if ec.breaker == nil {
+		return nil
+	}
+	ec.breaker.mutex.Lock()
+	defer ec.breaker.mutex.Unlock()
+	return ec.breaker.breakers[name]
+}
+
+//stats of breakers of every service client
+func (ec *EasyClient) ListBreakers() []BreakerStats {
+	ec.mutex.Lock()
+	clients := make([]*ServiceClient, 0, len(ec.clients))
+	for _, client := range ec.clients {
+		clients = append(clients, client)
+	}
+	ec.mutex.Unlock()
+
+	statsList := make([]BreakerStats, 0)
+	for _, client := range clients {
+		statsList = append(statsList, client.ListBreakers()...)
+	}
+	sort.Slice(statsList, func(i, j int) bool { return statsList[i].Name < statsList[j].Name })
+	return statsList
+}
+
+//get breaker of a service client by name "service.method" or "service.method@ip:port",nil if not found
+func (ec *EasyClient) GetBreaker(name string) *CircuitBreaker {
+	ec.mutex.Lock()
+	defer ec.mutex.Unlock()
+	for serviceName, client := range ec.clients {
+		if strings.HasPrefix(name, serviceName+".") {
+			if breaker := client.GetBreaker(name); breaker != nil {
+				return breaker
+			}
+		}
+	}
+	return nil
+}
+
+//fallback is called instead of returning ERROR_CIRCUIT_OPEN error when breaker of method is open,
+//it works with WithCircuitBreaker
+func (ec *ServiceClient) SetFallback(method string, fallback FallbackFunc) {
+	if ec.breaker == nil {
+		return
+	}
+	ec.breaker.mutex.Lock()
+	ec.breaker.fallbacks[method] = fallback
+	ec.breaker.mutex.Unlock()
+}
+
+//fallback of method of service serviceName,see ServiceClient.SetFallback
+func (ec *EasyClient) SetFallback(serviceName string, method string, fallback FallbackFunc) {
+	ec.getClient(serviceName).SetFallback(method, fallback)
+}
+
+//request through breaker of service method
+func (ec *ServiceClient) requestWithBreaker(format byte, head *EasyHead, body interface{}, timeout time.Duration) (*Node, *EasyPackage, error) {
+
+	if ec.breaker == nil {
+		return ec.requestWithRetry(format, head, body, timeout)
+	}
+
+	var node *Node
+	var respPkg *EasyPackage
+	err := ec.breaker.call(ec.serviceName+"."+head.GetMethod(), func() error {
+		var err error
+		node, respPkg, err = ec.requestWithRetry(format, head, body, timeout)
+		return err
+	})
+
+	sysErr, ok := err.(*SystemError)
+	if !ok || sysErr.GetRet() != ERROR_CIRCUIT_OPEN || respPkg != nil {
+		return node, respPkg, err
+	}
+	fallback := ec.breaker.getFallback(head.GetMethod())
+	if fallback == nil {
+		return nil, nil, err
+	}
+	respBody, err := fallback(head, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	//encode and decode so the body can be decoded like a response from network
+	pkgData, err := NewPackageWithBody(format, head, respBody).EncodeWithBody()
+	if err != nil {
+		return nil, nil, NewSystemError(ERROR_INTERNAL_ERROR, err.Error())
+	}
+	respPkg, err = DecodeWithBodyData(pkgData)
+	if err != nil {
+		return nil, nil, NewSystemError(ERROR_INTERNAL_ERROR, err.Error())
+	}
+	return nil, respPkg, nil
+}
+
+//send through breaker of node when breaking every node
+func (ec *ServiceClient) sendWithBreaker(node *Node, format byte, head *EasyHead, body interface{}, timeout time.Duration, tried map[string]bool) (*Node, *EasyPackage, error) {
+
+	if ec.breaker == nil || !ec.breaker.perNode {
+		return ec.send(node, format, head, body, timeout, tried)
+	}
+
+	var respNode *Node
+	var respPkg *EasyPackage
+	err := ec.breaker.call(ec.serviceName+"."+head.GetMethod()+"@"+node.GetAddr(), func() error {
+		var err error
+		respNode, respPkg, err = ec.send(node, format, head, body, timeout, tried)
+		return err
+	})
+	if respNode == nil {
+		//rejected by open breaker,nothing is sent so no outlier probe is started
+		tried[node.GetAddr()] = true
+		respNode = node
+	}
+	return respNode, respPkg, err
+}
@@ -0,0 +1,133 @@
+package easycall
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClientBreaker(t *testing.T) {
+
+	nodeList := []*Node{{Ip: "127.0.0.1", Port: newClosedPorts(t, 1)[0], Weight: 100}}
+	client := NewStaticServiceClient("breaker", nodeList, 10, LB_RANDOM, WithCircuitBreaker(NewBreakerPolicy()))
+
+	var err error
+	for i := 0; i < 20; i++ {
+		err = client.Request("GetProfile", map[string]interface{}{}, nil, time.Second)
+	}
+	if sysErr, ok := err.(*SystemError); !ok || sysErr.GetRet() != ERROR_CIRCUIT_OPEN {
+		t.Fatalf("breaker not open,err=%v", err)
+	}
+
+	client.SetFallback("GetProfile", func(head *EasyHead, body interface{}) (interface{}, error) {
+		return map[string]interface{}{"name": "fallback"}, nil
+	})
+	resp := make(map[string]interface{})
+	err = client.Request("GetProfile", map[string]interface{}{}, &resp, time.Second)
+	if err != nil || resp["name"] != "fallback" {
+		t.Fatalf("fallback not called,err=%v,resp=%v", err, resp)
+	}
+}
+
+func TestClientBreakerPerNode(t *testing.T) {
+
+	nodeList := startTestServices(t, 0, 0)
+	outlier := NewOutlierPolicy()
+	outlier.ConsecutiveErrors = 1
+	outlier.BaseEjectionTime = time.Millisecond * 50
+	policy := NewBreakerPolicy()
+	policy.PerNode = true
+	client := NewStaticServiceClient("profile", nodeList, 10, LB_ROUND_ROBIN, WithCircuitBreaker(policy), WithOutlierDetection(outlier))
+	other := NewStaticServiceClient("profile", nodeList, 10, LB_ROUND_ROBIN, WithCircuitBreaker(NewBreakerPolicy()))
+
+	resp := make(map[string]interface{})
+	for i := 0; i < 2; i++ {
+		err := client.Request("GetProfile", map[string]interface{}{}, &resp, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	bad := nodeList[0]
+	breaker := client.GetBreaker("profile.GetProfile@" + bad.GetAddr())
+	if breaker == nil || len(client.ListBreakers()) != 3 || len(other.ListBreakers()) != 0 {
+		t.Fatalf("unexpected breakers:%v", client.ListBreakers())
+	}
+
+	//requests rejected by the open node breaker must not start outlier probes
+	breaker.ForceOpen()
+	client.outlier.report(bad, NewSystemError(ERROR_TIME_OUT, "request time out"))
+	time.Sleep(time.Millisecond * 60)
+	for i := 0; i < 4; i++ {
+		client.Request("GetProfile", map[string]interface{}{}, &resp, time.Second)
+	}
+	client.outlier.mutex.Lock()
+	probing := client.outlier.healths[bad.GetAddr()].probing
+	client.outlier.mutex.Unlock()
+	if probing {
+		t.Fatal("node pinned as probing by breaker rejection")
+	}
+
+	//breakers of nodes gone are dropped
+	client.onNodesChanged(nodeList[1:])
+	if client.GetBreaker("profile.GetProfile@"+bad.GetAddr()) != nil || len(client.ListBreakers()) != 2 {
+		t.Fatalf("breakers of removed node kept:%v", client.ListBreakers())
+	}
+}
+
+func TestClientBreakerSkipOpenNode(t *testing.T) {
+
+	nodeList := startTestServices(t, 0, 0)
+	policy := NewBreakerPolicy()
+	policy.PerNode = true
+	client := NewStaticServiceClient("profile", nodeList, 10, LB_ROUND_ROBIN, WithCircuitBreaker(policy))
+
+	resp := make(map[string]interface{})
+	for i := 0; i < 2; i++ {
+		client.Request("GetProfile", map[string]interface{}{}, &resp, time.Second)
+	}
+	client.GetBreaker("profile.GetProfile@" + nodeList[0].GetAddr()).ForceOpen()
+	for i := 0; i < 20; i++ {
+		err := client.Request("GetProfile", map[string]interface{}{}, &resp, time.Second)
+		if err != nil || respPort(resp) != nodeList[1].Port {
+			t.Fatalf("node with open breaker picked,err=%v,resp=%v", err, resp)
+		}
+	}
+
+	//rejections of open node breakers are not failures of method breaker
+	client.GetBreaker("profile.GetProfile@" + nodeList[1].GetAddr()).ForceOpen()
+	for i := 0; i < 20; i++ {
+		client.Request("GetProfile", map[string]interface{}{}, &resp, time.Second)
+	}
+	if stats := client.GetBreaker("profile.GetProfile").GetStats(); stats.Status != CB_STATUS_CLOSE || stats.Failures != 0 {
+		t.Fatalf("method breaker counts node breaker rejections:%v", stats)
+	}
+}
+
+func TestEasyClientBreaker(t *testing.T) {
+
+	nodeList := []*Node{{Ip: "127.0.0.1", Port: newClosedPorts(t, 1)[0], Weight: 100}}
+	client := NewStaticEasyClient(map[string][]*Node{"breaker": nodeList}, 10, LB_RANDOM, WithCircuitBreaker(NewBreakerPolicy()))
+
+	var err error
+	for i := 0; i < 20; i++ {
+		err = client.Request("breaker", "GetProfile", map[string]interface{}{}, nil, time.Second)
+	}
+	if sysErr, ok := err.(*SystemError); !ok || sysErr.GetRet() != ERROR_CIRCUIT_OPEN {
+		t.Fatalf("breaker not open,err=%v", err)
+	}
+	statsList := client.ListBreakers()
+	if len(statsList) != 1 || statsList[0].Name != "breaker.GetProfile" || statsList[0].Status != CB_STATUS_OPEN {
+		t.Fatalf("unexpected breakers:%v", statsList)
+	}
+	if client.GetBreaker("breaker.GetProfile") == nil || client.GetBreaker("profile.GetProfile") != nil {
+		t.Fatal("breaker not found by name")
+	}
+
+	client.SetFallback("breaker", "GetProfile", func(head *EasyHead, body interface{}) (interface{}, error) {
+		return map[string]interface{}{"name": "fallback"}, nil
+	})
+	resp := make(map[string]interface{})
+	err = client.Request("breaker", "GetProfile", map[string]interface{}{}, &resp, time.Second)
+	if err != nil || resp["name"] != "fallback" {
+		t.Fatalf("fallback not called,err=%v,resp=%v", err, resp)
+	}
+}
@@ -0,0 +1,92 @@
+package easycall
+
+import "time"
+
+//ClientOption configures a ServiceClient,options given to EasyClient apply to all its service clients
+type ClientOption func(ec *ServiceClient)
+
+//name balancer registered by RegisterBalancer,it replaces loadBalanceType
+func WithBalancer(name string) ClientOption {
+	return func(ec *ServiceClient) {
+		ec.balancerName = name
+	}
+}
+
+//route requests to nodes in the caller's zone first
+func WithLocality(policy *LocalityPolicy) ClientOption {
+	return func(ec *ServiceClient) {
+		ec.locality = policy
+	}
+}
+
+//choose candidate nodes by route rules before locality and load balance
+func WithRouter(router *Router) ClientOption {
+	return func(ec *ServiceClient) {
+		ec.router = router
+	}
+}
+
+//ramp weight of a newly started node up to its Weight during window,
+//it works with weighted balancers like random_weight and smooth_weight
+func WithSlowStart(window time.Duration) ClientOption {
+	return func(ec *ServiceClient) {
+		ec.slowStart = window
+	}
+}
+
+//eject nodes failing with system errors or timeouts from selection,see NewOutlierPolicy for defaults
+func WithOutlierDetection(policy *OutlierPolicy) ClientOption {
+	return func(ec *ServiceClient) {
+		ec.outlier = newOutlierDetector(policy)
+	}
+}
+
+//retry failed requests on other nodes,it applies to Request and RequestWithHead
+func WithRetryPolicy(policy *RetryPolicy) ClientOption {
+	return func(ec *ServiceClient) {
+		ec.retry = policy
+	}
+}
+
+//hedge requests of idempotent methods to reduce tail latency,it applies to Request and RequestWithHead
+func WithHedgePolicy(policy *HedgePolicy) ClientOption {
+	return func(ec *ServiceClient) {
+		ec.hedge = newHedger(policy)
+	}
+}
+
+//max requests in flight of a Broadcast,default BROADCAST_CONCURRENCY
+func WithBroadcastConcurrency(concurrency int) ClientOption {
+	return func(ec *ServiceClient) {
+		ec.broadcastConcurrency = concurrency
+	}
+}
+
+//identical in-flight requests of methods share one network call and one response,
+//requests are identical when service,method,body and caller head fields are equal
+func WithCoalescing(methods ...string) ClientOption {
+	return func(ec *ServiceClient) {
+		ec.coalescer = newCoalescer(methods)
+	}
+}
+
+//break requests per service method,and per node if policy.PerNode is set,see SetFallback
+func WithCircuitBreaker(policy *BreakerPolicy) ClientOption {
+	return func(ec *ServiceClient) {
+		ec.breaker = newClientBreaker(policy)
+	}
+}
+
+//limit concurrent requests to the service,see NewBulkhead
+func WithBulkhead(maxConcurrent int, maxQueue int, waitTime time.Duration) ClientOption {
+	return func(ec *ServiceClient) {
+		ec.bulkhead = NewBulkhead(ec.serviceName, maxConcurrent, maxQueue, waitTime)
+	}
+}
+
+//name service name of the caller,it is sent in head meta META_CALLER for server side rate limit by caller
+func WithCaller(name string) ClientOption {
+	return func(ec *ServiceClient) {
+		ec.caller = name
+	}
+}
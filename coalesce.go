@@ -0,0 +1,89 @@
+package easycall
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//an in-flight request shared by identical requests
+type flight struct {
+	wg      sync.WaitGroup
+	node    *Node
+	respPkg *EasyPackage
+	err     error
+}
+
+//coalescer shares one network call among identical in-flight requests of coalesced methods
+type coalescer struct {
+	methods map[string]bool
+	mutex   *sync.Mutex
+	flights map[string]*flight
+}
+
+func newCoalescer(methods []string) *coalescer {
+	c := &coalescer{methods: make(map[string]bool, 0), mutex: &sync.Mutex{}, flights: make(map[string]*flight, 0)}
+	for _, method := range methods {
+		c.methods[method] = true
+	}
+	return c
+}
+
+func (c *coalescer) coalesced(method string) bool {
+	return c.methods[method]
+}
+
+//key of identical requests,requests of different callers like uid and token are not identical,
+//body is keyed by the bytes sent,ok is false when body can't be encoded
+func requestKey(format byte, head *EasyHead, body interface{}) (string, bool) {
+
+	bodyData, isData := body.([]byte)
+	if !isData {
+		var err error
+		bodyData, err = NewPackageWithBody(format, head, body).EncodeBody()
+		if err != nil {
+			return "", false
+		}
+	}
+
+	var key strings.Builder
+	key.WriteString(head.GetService() + "\n" + head.GetMethod() + "\n" + strconv.Itoa(int(format)) + "\n")
+	key.WriteString(head.GetRouteKey() + "\n" + strconv.FormatUint(head.GetUid(), 10) + "\n" + head.GetToken() + "\n")
+	metaKeys := make([]string, 0, len(head.Meta))
+	for k := range head.Meta {
+		if k != META_NO_CACHE {
+			metaKeys = append(metaKeys, k)
+		}
+	}
+	sort.Strings(metaKeys)
+	for _, k := range metaKeys {
+		key.WriteString(k + "=" + head.Meta[k] + "\n")
+	}
+	key.Write(bodyData)
+	return key.String(), true
+}
+
+//call fn once for identical in-flight requests,all of them get its result
+func (c *coalescer) do(key string, fn func() (*Node, *EasyPackage, error)) (*Node, *EasyPackage, error) {
+
+	c.mutex.Lock()
+	if f, ok := c.flights[key]; ok {
+		c.mutex.Unlock()
+		f.wg.Wait()
+		return f.node, f.respPkg, f.err
+	}
+	f := &flight{}
+	f.wg.Add(1)
+	c.flights[key] = f
+	c.mutex.Unlock()
+
+	defer func() {
+		c.mutex.Lock()
+		delete(c.flights, key)
+		c.mutex.Unlock()
+		f.wg.Done()
+	}()
+	f.node, f.respPkg, f.err = fn()
+	return f.node, f.respPkg, f.err
+}
@@ -0,0 +1,67 @@
+package easycall
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type countService struct {
+	count int32
+}
+
+func (s *countService) GetProfile(req *Request, resp *Response) {
+	atomic.AddInt32(&s.count, 1)
+	time.Sleep(time.Millisecond * 50)
+	resp.SetBody(map[string]interface{}{"count": atomic.LoadInt32(&s.count)})
+}
+
+func TestCoalescing(t *testing.T) {
+
+	service := &countService{}
+	port := newClosedPorts(t, 1)[0]
+	err := (&Server{}).CreateServer(port, NewServiceHandler(service, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodeList := []*Node{{Ip: "127.0.0.1", Port: port, Weight: 100}}
+	client := NewStaticServiceClient("profile", nodeList, 10, LB_RANDOM, WithCoalescing("GetProfile"))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(uid uint64) {
+			defer wg.Done()
+			resp := make(map[string]interface{})
+			err := client.Request("GetProfile", map[string]interface{}{"id": 1}, &resp, time.Second, WithUid(uid))
+			if err != nil {
+				t.Error(err)
+			}
+		}(uint64(i % 2))
+	}
+	wg.Wait()
+
+	//requests of 2 uids
+	if atomic.LoadInt32(&service.count) != 2 {
+		t.Fatalf("expect 2 network calls,got %d", service.count)
+	}
+}
+
+func TestRequestKey(t *testing.T) {
+
+	head := NewEasyHead().SetService("profile").SetMethod("GetProfile").SetUid(1)
+	body := map[string]interface{}{"id": 1, "name": "test"}
+	bodyData, err := NewPackageWithBody(FORMAT_MSGPACK, head, body).EncodeBody()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, ok := requestKey(FORMAT_MSGPACK, head, body)
+	dataKey, dataOk := requestKey(FORMAT_MSGPACK, head, bodyData)
+	if !ok || !dataOk || key != dataKey {
+		t.Fatal("body not keyed by its encoded bytes")
+	}
+	if _, ok := requestKey(FORMAT_MSGPACK, head, map[string]interface{}{"ch": make(chan int)}); ok {
+		t.Fatal("unencodable body keyed")
+	}
+}
@@ -3,64 +3,92 @@ package easycall
 import (
 	"sync"
 	"time"
+
+	"github.com/starjiang/elog"
 )
 
 type EasyClient struct {
 	clients         map[string]*ServiceClient
 	mutex           *sync.Mutex
-	endpoints       []string
+	registry        Registry
 	poolSize        int
 	loadbalanceType int
+	opts            []ClientOption
+	interceptors    []InterceptorFunc
+}
+
+//opts client options applied to every service client
+func NewEasyClient(endpoints []string, poolSize int, loadbalanceType int, opts ...ClientOption) *EasyClient {
+	registry, err := NewEtcdRegistry(endpoints, ETCD_CONNECT_TIMEOUT*time.Second)
+	if err != nil {
+		elog.Error("new registry fail:", err)
+		return NewEasyClientWithRegistry(nil, poolSize, loadbalanceType, opts...)
+	}
+	return NewEasyClientWithRegistry(registry, poolSize, loadbalanceType, opts...)
 }
 
-func NewEasyClient(endpoints []string, poolSize int, loadbalanceType int) *EasyClient {
-	return &EasyClient{endpoints: endpoints, mutex: &sync.Mutex{}, clients: make(map[string]*ServiceClient, 0), poolSize: poolSize, loadbalanceType: loadbalanceType}
+//services fixed nodes of every service,keyed by service name
+//opts client options applied to every service client
+func NewStaticEasyClient(services map[string][]*Node, poolSize int, loadbalanceType int, opts ...ClientOption) *EasyClient {
+	return NewEasyClientWithRegistry(NewStaticRegistry(services), poolSize, loadbalanceType, opts...)
 }
 
-func (ec *EasyClient) Request(serviceName string, method string, reqBody interface{}, respBody interface{}, timeout time.Duration) error {
+//registry shared by all service clients to discover service nodes
+//opts client options applied to every service client
+func NewEasyClientWithRegistry(registry Registry, poolSize int, loadbalanceType int, opts ...ClientOption) *EasyClient {
+	return &EasyClient{registry: registry, mutex: &sync.Mutex{}, clients: make(map[string]*ServiceClient, 0), poolSize: poolSize, loadbalanceType: loadbalanceType, opts: opts}
+}
+
+//opts call options like WithRouteKey,WithFormat,WithTimeout
+func (ec *EasyClient) Request(serviceName string, method string, reqBody interface{}, respBody interface{}, timeout time.Duration, opts ...CallOption) error {
 
-	ch, err := ec.RequestAsyncWithHead(FORMAT_MSGPACK, NewEasyHead().SetService(serviceName).SetMethod(method), reqBody, timeout)
+	co := newCallOptions(serviceName, method, timeout, opts)
+	respPkg, err := ec.RequestWithHead(co.format, co.head, reqBody, co.timeout)
 
+	if err == nil {
+		err = getPkgError(respPkg)
+	}
 	if err != nil {
 		return err
 	}
-	respPkg := <-ch
-	if respPkg == nil {
-		return NewSystemError(ERROR_TIME_OUT, "request time out")
-	}
-	if respPkg.GetHead().GetRet() != 0 {
-		return NewLogicError(respPkg.GetHead().GetRet(), respPkg.GetHead().GetMsg())
-	}
 	return respPkg.DecodeBody(respBody)
 }
 
-func (ec *EasyClient) RequestAsync(serviceName string, method string, reqBody interface{}, timeout time.Duration) (chan *EasyPackage, error) {
-	return ec.RequestAsyncWithHead(FORMAT_MSGPACK, NewEasyHead().SetService(serviceName).SetMethod(method), reqBody, timeout)
+//opts call options like WithRouteKey,WithFormat,WithTimeout
+func (ec *EasyClient) RequestAsync(serviceName string, method string, reqBody interface{}, timeout time.Duration, opts ...CallOption) (chan *EasyPackage, error) {
+	co := newCallOptions(serviceName, method, timeout, opts)
+	return ec.RequestAsyncWithHead(co.format, co.head, reqBody, co.timeout)
 }
 
 func (ec *EasyClient) RequestWithHead(format byte, head *EasyHead, reqBody interface{}, timeout time.Duration) (*EasyPackage, error) {
+	return ec.getClient(head.GetService()).RequestWithHead(format, head, reqBody, timeout)
+}
 
-	ch, err := ec.RequestAsyncWithHead(format, head, reqBody, timeout)
+func (ec *EasyClient) RequestAsyncWithHead(format byte, head *EasyHead, reqBody interface{}, timeout time.Duration) (chan *EasyPackage, error) {
+	return ec.getClient(head.GetService()).RequestAsyncWithHead(format, head, reqBody, timeout)
+}
 
-	if err != nil {
-		return nil, err
-	}
-	respPkg := <-ch
-	if respPkg == nil {
-		return nil, NewSystemError(ERROR_TIME_OUT, "request time out")
+//interceptor for interceptor function chain of requests to every service
+func (ec *EasyClient) AddInterceptor(interceptor InterceptorFunc) {
+	ec.mutex.Lock()
+	ec.interceptors = append(ec.interceptors, interceptor)
+	for _, client := range ec.clients {
+		client.AddInterceptor(interceptor)
 	}
-	return respPkg, nil
+	ec.mutex.Unlock()
 }
 
-func (ec *EasyClient) RequestAsyncWithHead(format byte, head *EasyHead, reqBody interface{}, timeout time.Duration) (chan *EasyPackage, error) {
+func (ec *EasyClient) getClient(serviceName string) *ServiceClient {
 
 	ec.mutex.Lock()
-	client := ec.clients[head.GetService()]
+	client := ec.clients[serviceName]
 	if client == nil {
-		client = NewServiceClient(ec.endpoints, head.GetService(), ec.poolSize, ec.loadbalanceType)
-		ec.clients[head.GetService()] = client
+		client = NewServiceClientWithRegistry(ec.registry, serviceName, ec.poolSize, ec.loadbalanceType, ec.opts...)
+		for _, interceptor := range ec.interceptors {
+			client.AddInterceptor(interceptor)
+		}
+		ec.clients[serviceName] = client
 	}
 	ec.mutex.Unlock()
-
-	return client.RequestAsyncWithHead(format, head, reqBody, timeout)
+	return client
 }
@@ -20,16 +20,17 @@ const (
 
 //EasyHead for EasyPackage
 type EasyHead struct {
-	Service   string `json:"service"`   //service name
-	Method    string `json:"method"`    //service method
-	RouteKey  string `json:"routeKey"`  //for hash loadbalnce
-	Token     string `json:"token"`     // user login token
-	Uid       uint64 `json:"uid"`       //user login Uid
-	RequestIp string `json:"requestIp"` //set caller's internet ip address
-	TraceId   string `json:"traceId"`   //traceId for trace request call chain
-	Seq       uint64 `json:"seq"`       //seq for async call
-	Ret       int    `json:"ret"`       //ret code,when process failed,set error code into it
-	Msg       string `json:"msg"`       //msg,when process failed,set errmsg into it
+	Service   string            `json:"service"`        //service name
+	Method    string            `json:"method"`         //service method
+	RouteKey  string            `json:"routeKey"`       //for hash loadbalnce
+	Token     string            `json:"token"`          // user login token
+	Uid       uint64            `json:"uid"`            //user login Uid
+	RequestIp string            `json:"requestIp"`      //set caller's internet ip address
+	TraceId   string            `json:"traceId"`        //traceId for trace request call chain
+	Seq       uint64            `json:"seq"`            //seq for async call
+	Ret       int               `json:"ret"`            //ret code,when process failed,set error code into it
+	Msg       string            `json:"msg"`            //msg,when process failed,set errmsg into it
+	Meta      map[string]string `json:"meta,omitempty"` //user defined head fields
 }
 
 func NewEasyHead() *EasyHead {
@@ -70,6 +71,10 @@ func (head *EasyHead) GetMsg() string {
 	return head.Msg
 }
 
+func (head *EasyHead) GetMeta(key string) string {
+	return head.Meta[key]
+}
+
 func (head *EasyHead) SetService(service string) *EasyHead {
 	head.Service = service
 	return head
@@ -120,6 +125,14 @@ func (head *EasyHead) SetMsg(msg string) *EasyHead {
 	return head
 }
 
+func (head *EasyHead) SetMeta(key string, value string) *EasyHead {
+	if head.Meta == nil {
+		head.Meta = make(map[string]string, 0)
+	}
+	head.Meta[key] = value
+	return head
+}
+
 //EasyPackage for Easycall
 type EasyPackage struct {
 	format   byte        // pkg format 0 for msgpack,1 for json
@@ -301,6 +314,27 @@ func (pkg *EasyPackage) EncodeWithBodyData() ([]byte, error) {
 
 }
 
+//encode body only,the result can be sent with EncodeWithBodyData,
+//map keys are sorted like json does,so equal bodies are encoded the same
+func (pkg *EasyPackage) EncodeBody() ([]byte, error) {
+
+	var buf bytes.Buffer
+	if pkg.format == FORMAT_MSGPACK {
+		err := msgpack.NewEncoder(&buf).UseJSONTag(true).SortMapKeys(true).Encode(pkg.body)
+		if err != nil {
+			return nil, err
+		}
+	} else if pkg.format == FORMAT_JSON {
+		err := json.NewEncoder(&buf).Encode(pkg.body)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, errors.New("invalid pkg format")
+	}
+	return buf.Bytes(), nil
+}
+
 func (pkg *EasyPackage) GetFormat() byte {
 	return pkg.format
 }
@@ -7,6 +7,11 @@ const (
 	ERROR_SERVICE_NOT_FOUND = 1002
 	ERROR_INTERNAL_ERROR    = 1001
 	ERROR_TIME_OUT          = 1003
+	ERROR_SERVICE_BUSY      = 1004 //service is overloaded and the request is not processed
+	ERROR_CONNECTION_LOST   = 1005 //connection to the node fails before the request is sent
+	ERROR_CIRCUIT_OPEN      = 1006 //request is rejected by an open circuit breaker
+	ERROR_BULKHEAD_FULL     = 1007 //request is rejected by a full bulkhead
+	ERROR_RATE_LIMITED      = 1008 //request is rejected by the rate limiter of service
 	ERROR_MAX_SYSTEM_CODE   = 2000 //the max system error code,less than 2000 is system error,more than 2000 is logic error
 )
 
@@ -51,3 +56,18 @@ func (e *SystemError) GetRet() int {
 func (e *SystemError) GetMsg() string {
 	return e.msg
 }
+
+//get the error of a response package,nil package means request time out
+func getPkgError(respPkg *EasyPackage) error {
+	if respPkg == nil {
+		return NewSystemError(ERROR_TIME_OUT, "request time out")
+	}
+	ret := respPkg.GetHead().GetRet()
+	if ret == 0 {
+		return nil
+	}
+	if ret < ERROR_MAX_SYSTEM_CODE {
+		return NewSystemError(ret, respPkg.GetHead().GetMsg())
+	}
+	return NewLogicError(ret, respPkg.GetHead().GetMsg())
+}
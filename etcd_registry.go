@@ -0,0 +1,216 @@
+package easycall
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/starjiang/elog"
+)
+
+type etcdKeeper struct {
+	leaseId clientv3.LeaseID
+	stop    chan struct{}
+}
+
+//EtcdRegistry keeps service nodes under EASYCALL_ETCD_SERVICE_PATH with a keepalive lease
+type EtcdRegistry struct {
+	cli     *clientv3.Client
+	timeout time.Duration
+	mutex   *sync.Mutex
+	keepers map[string]*etcdKeeper
+	ctx     context.Context //cancelled by Close to stop watches
+	cancel  context.CancelFunc
+}
+
+//endpoints etcd endpoints list
+//timeout etcd dial and request timeout
+func NewEtcdRegistry(endpoints []string, timeout time.Duration) (*EtcdRegistry, error) {
+	cli, err := clientv3.New(clientv3.Config{
+		Endpoints:   endpoints,
+		DialTimeout: timeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	registry := &EtcdRegistry{}
+	registry.cli = cli
+	registry.timeout = timeout
+	registry.mutex = &sync.Mutex{}
+	registry.keepers = make(map[string]*etcdKeeper, 0)
+	registry.ctx, registry.cancel = context.WithCancel(context.Background())
+	return registry, nil
+}
+
+func (er *EtcdRegistry) servicePath(name string) string {
+	return EASYCALL_ETCD_SERVICE_PATH + "/" + name + "/nodes"
+}
+
+func (er *EtcdRegistry) nodeKey(name string, node *Node) string {
+	return er.servicePath(name) + "/" + node.GetAddr()
+}
+
+func (er *EtcdRegistry) Register(name string, node *Node) error {
+
+	node = copyNode(node)
+	if node.StartTime == 0 {
+		node.StartTime = GetTimeNow()
+	}
+
+	nodeKey := er.nodeKey(name, node)
+	leaseId, err := er.put(nodeKey, node)
+	if err != nil {
+		return err
+	}
+
+	er.mutex.Lock()
+	keeper := er.keepers[nodeKey]
+	if keeper == nil {
+		keeper = &etcdKeeper{leaseId: leaseId, stop: make(chan struct{})}
+		er.keepers[nodeKey] = keeper
+		go er.keepAlive(name, nodeKey, node, keeper)
+	} else {
+		keeper.leaseId = leaseId
+	}
+	er.mutex.Unlock()
+	return nil
+}
+
+func (er *EtcdRegistry) Deregister(name string, node *Node) error {
+
+	nodeKey := er.nodeKey(name, node)
+
+	er.mutex.Lock()
+	keeper := er.keepers[nodeKey]
+	if keeper != nil {
+		close(keeper.stop)
+		delete(er.keepers, nodeKey)
+	}
+	er.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), er.timeout)
+	_, err := er.cli.Delete(ctx, nodeKey)
+	cancel()
+	return err
+}
+
+func (er *EtcdRegistry) List(name string) ([]*Node, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), er.timeout)
+	resp, err := er.cli.Get(ctx, er.servicePath(name), clientv3.WithPrefix())
+	cancel()
+
+	if err != nil {
+		return nil, err
+	}
+
+	nodeList := make([]*Node, 0)
+	for _, ev := range resp.Kvs {
+		node := &Node{}
+		err = json.Unmarshal(ev.Value, node)
+		if err != nil {
+			elog.Error("decode child data fail:", err)
+			continue
+		}
+		nodeList = append(nodeList, node)
+	}
+	return nodeList, nil
+}
+
+func (er *EtcdRegistry) Watch(name string, watcher WatchFunc) error {
+
+	path := er.servicePath(name)
+	//children changed reload,stop when registry is closed
+	go func() {
+		for {
+			rch := er.cli.Watch(er.ctx, path, clientv3.WithPrefix())
+			for range rch {
+				elog.Info(path, "node reload")
+				nodeList, err := er.List(name)
+				if err != nil {
+					elog.Error(path, "node reload fail:", err)
+					continue
+				}
+				watcher(nodeList)
+			}
+			if er.ctx.Err() != nil {
+				return
+			}
+			elog.Error(path, "watch failed")
+			time.Sleep(time.Second)
+		}
+	}()
+	return nil
+}
+
+func (er *EtcdRegistry) Close() error {
+	er.cancel()
+	er.mutex.Lock()
+	for nodeKey, keeper := range er.keepers {
+		close(keeper.stop)
+		delete(er.keepers, nodeKey)
+	}
+	er.mutex.Unlock()
+	return er.cli.Close()
+}
+
+func (er *EtcdRegistry) put(nodeKey string, node *Node) (clientv3.LeaseID, error) {
+
+	nodeData, err := json.Marshal(node)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), er.timeout)
+	lresp, err := er.cli.Grant(ctx, ETCD_KEEPLIVE_TIMEOUT)
+	cancel()
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), er.timeout)
+	_, err = er.cli.Put(ctx, nodeKey, string(nodeData), clientv3.WithLease(lresp.ID))
+	cancel()
+	if err != nil {
+		return 0, err
+	}
+	return lresp.ID, nil
+}
+
+func (er *EtcdRegistry) keepAlive(name string, nodeKey string, node *Node, keeper *etcdKeeper) {
+
+	ticker := time.NewTicker(time.Second * time.Duration(ETCD_HEARTBEAT_INTEVAL))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-keeper.stop:
+			return
+		case <-ticker.C:
+		}
+
+		er.mutex.Lock()
+		leaseId := keeper.leaseId
+		er.mutex.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), er.timeout)
+		_, err := er.cli.KeepAliveOnce(ctx, leaseId)
+		cancel()
+		if err != nil {
+			elog.Error("send keepalive fail,", err)
+			leaseId, err = er.put(nodeKey, node)
+			if err != nil {
+				elog.Error("register again fail,", err)
+				continue
+			}
+			er.mutex.Lock()
+			keeper.leaseId = leaseId
+			er.mutex.Unlock()
+			continue
+		}
+		elog.Info(name, "send etcd keepalive success")
+	}
+}
@@ -0,0 +1,199 @@
+package easycall
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/starjiang/elog"
+)
+
+const (
+	FILE_REGISTRY_CHECK_INTERVAL = 3
+)
+
+//FileRegistry keeps service addresses in a local json file and reloads it when the file changes
+//file content looks like {"profile":[{"ip":"127.0.0.1","port":8001,"weight":100}]}
+type FileRegistry struct {
+	mutex     *sync.Mutex
+	path      string
+	modTime   time.Time
+	services  map[string][]*Node
+	watchers  map[string][]WatchFunc
+	stop      chan struct{} //closed by Close to stop checking file
+	closeOnce *sync.Once
+}
+
+//path registry file path,an absent file is treated as empty
+func NewFileRegistry(path string) (*FileRegistry, error) {
+	registry := &FileRegistry{}
+	registry.mutex = &sync.Mutex{}
+	registry.path = path
+	registry.services = make(map[string][]*Node, 0)
+	registry.watchers = make(map[string][]WatchFunc, 0)
+	registry.stop = make(chan struct{})
+	registry.closeOnce = &sync.Once{}
+
+	_, err := registry.load()
+	if err != nil {
+		return nil, err
+	}
+	go registry.checkModify()
+	return registry, nil
+}
+
+func (fr *FileRegistry) Register(name string, node *Node) error {
+	fr.mutex.Lock()
+	_, err := fr.load()
+	if err != nil {
+		fr.mutex.Unlock()
+		return err
+	}
+	fr.services[name] = upsertNode(fr.services[name], node)
+	err = fr.save()
+	fr.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	fr.notify(name)
+	return nil
+}
+
+func (fr *FileRegistry) Deregister(name string, node *Node) error {
+	fr.mutex.Lock()
+	_, err := fr.load()
+	if err != nil {
+		fr.mutex.Unlock()
+		return err
+	}
+	fr.services[name] = removeNode(fr.services[name], node)
+	err = fr.save()
+	fr.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	fr.notify(name)
+	return nil
+}
+
+func (fr *FileRegistry) List(name string) ([]*Node, error) {
+	fr.mutex.Lock()
+	defer fr.mutex.Unlock()
+	return copyNodes(fr.services[name]), nil
+}
+
+func (fr *FileRegistry) Watch(name string, watcher WatchFunc) error {
+	fr.mutex.Lock()
+	fr.watchers[name] = append(fr.watchers[name], watcher)
+	fr.mutex.Unlock()
+	return nil
+}
+
+//reload services from file if it was modified,services are cleared when the loaded file is deleted,
+//must be called with mutex held
+func (fr *FileRegistry) load() (bool, error) {
+	info, err := os.Stat(fr.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return false, err
+		}
+		if fr.modTime.IsZero() {
+			return false, nil
+		}
+		fr.services = make(map[string][]*Node, 0)
+		fr.modTime = time.Time{}
+		return true, nil
+	}
+	if info.ModTime().Equal(fr.modTime) {
+		return false, nil
+	}
+
+	data, err := ioutil.ReadFile(fr.path)
+	if err != nil {
+		return false, err
+	}
+	services := make(map[string][]*Node, 0)
+	if len(data) > 0 {
+		err = json.Unmarshal(data, &services)
+		if err != nil {
+			return false, err
+		}
+	}
+	fr.services = services
+	fr.modTime = info.ModTime()
+	return true, nil
+}
+
+//write services to file,must be called with mutex held
+func (fr *FileRegistry) save() error {
+	data, err := json.MarshalIndent(fr.services, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(fr.path, data, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(fr.path)
+	if err != nil {
+		return err
+	}
+	fr.modTime = info.ModTime()
+	return nil
+}
+
+//stop checking file changes,watchers are not notified any more
+func (fr *FileRegistry) Close() error {
+	fr.closeOnce.Do(func() {
+		close(fr.stop)
+	})
+	return nil
+}
+
+func (fr *FileRegistry) checkModify() {
+	ticker := time.NewTicker(time.Second * FILE_REGISTRY_CHECK_INTERVAL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			fr.check()
+		case <-fr.stop:
+			return
+		}
+	}
+}
+
+//reload file and notify all watchers if it changed
+func (fr *FileRegistry) check() {
+	fr.mutex.Lock()
+	changed, err := fr.load()
+	names := make([]string, 0, len(fr.watchers))
+	for name := range fr.watchers {
+		names = append(names, name)
+	}
+	fr.mutex.Unlock()
+
+	if err != nil {
+		elog.Error("reload registry file fail:", err)
+		return
+	}
+	if changed {
+		elog.Info(fr.path, "registry file reload")
+		for _, name := range names {
+			fr.notify(name)
+		}
+	}
+}
+
+func (fr *FileRegistry) notify(name string) {
+	fr.mutex.Lock()
+	watchers := fr.watchers[name]
+	fr.mutex.Unlock()
+
+	for _, watcher := range watchers {
+		nodeList, _ := fr.List(name)
+		watcher(nodeList)
+	}
+}
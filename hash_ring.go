@@ -0,0 +1,94 @@
+package easycall
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+)
+
+const (
+	HASH_RING_REPLICAS = 160 //virtual nodes of a node with weight 100
+)
+
+type ringPoint struct {
+	hash uint32
+	node *Node
+}
+
+//consistent hash ring,every node owns virtual nodes in proportion to its own weight,
+//so nodes joining or leaving never change virtual nodes of others
+type hashRing struct {
+	points []ringPoint
+}
+
+func newHashRing(nodeList []*Node) *hashRing {
+
+	ring := &hashRing{}
+	if len(nodeList) == 0 {
+		return ring
+	}
+
+	ring.points = make([]ringPoint, 0, HASH_RING_REPLICAS*len(nodeList))
+	for _, node := range nodeList {
+		replicas := HASH_RING_REPLICAS * ringWeight(node) / 100
+		if replicas < 1 {
+			replicas = 1
+		}
+		addr := node.GetAddr()
+		for i := 0; i < replicas; i++ {
+			hash := crc32.ChecksumIEEE([]byte(addr + "#" + strconv.Itoa(i)))
+			ring.points = append(ring.points, ringPoint{hash, node})
+		}
+	}
+	sort.Slice(ring.points, func(i, j int) bool {
+		return ring.points[i].hash < ring.points[j].hash
+	})
+	return ring
+}
+
+//node with weight 0 still keeps a minimal share
+func ringWeight(node *Node) int {
+	if node.Weight < 1 {
+		return 1
+	}
+	return node.Weight
+}
+
+func (r *hashRing) search(hash uint32) int {
+	index := sort.Search(len(r.points), func(i int) bool {
+		return r.points[i].hash >= hash
+	})
+	if index == len(r.points) {
+		index = 0
+	}
+	return index
+}
+
+//get the first node clockwise from hash
+func (r *hashRing) get(hash uint32) *Node {
+	if len(r.points) == 0 {
+		return nil
+	}
+	return r.points[r.search(hash)].node
+}
+
+//get the first node clockwise from hash which is one of nodeList,
+//so keys of a node not in nodeList move to its neighbours only
+func (r *hashRing) pick(hash uint32, nodeList []*Node) *Node {
+	if len(r.points) == 0 {
+		if len(nodeList) == 0 {
+			return nil
+		}
+		return nodeList[hash%uint32(len(nodeList))]
+	}
+	index := r.search(hash)
+	for i := 0; i < len(r.points); i++ {
+		point := r.points[(index+i)%len(r.points)]
+		for _, node := range nodeList {
+			if node.Ip == point.node.Ip && node.Port == point.node.Port {
+				return node
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package easycall
+
+import (
+	"hash/crc32"
+	"strconv"
+	"testing"
+)
+
+func newTestNodes(count int, weight int) []*Node {
+	nodeList := make([]*Node, 0, count)
+	for i := 0; i < count; i++ {
+		nodeList = append(nodeList, &Node{Ip: "10.0.0." + strconv.Itoa(i+1), Port: 8001, Weight: weight})
+	}
+	return nodeList
+}
+
+func ringOwners(ring *hashRing, keys int) []string {
+	owners := make([]string, 0, keys)
+	for i := 0; i < keys; i++ {
+		owners = append(owners, ring.get(crc32.ChecksumIEEE([]byte("uid"+strconv.Itoa(i)))).GetAddr())
+	}
+	return owners
+}
+
+func TestHashRingAddNode(t *testing.T) {
+
+	keys := 20000
+	for _, weights := range [][]int{{100, 100, 100, 100, 100, 100, 100, 100, 100, 100}, {400, 100, 100, 100}} {
+		nodeList := newTestNodes(len(weights), 100)
+		total := 100
+		for i, weight := range weights {
+			nodeList[i].Weight = weight
+			total += weight
+		}
+		before := ringOwners(newHashRing(nodeList), keys)
+
+		newNode := &Node{Ip: "10.0.0.100", Port: 8001, Weight: 100}
+		after := ringOwners(newHashRing(append(nodeList, newNode)), keys)
+
+		moved := 0
+		for i := 0; i < keys; i++ {
+			if before[i] != after[i] {
+				moved++
+				if after[i] != newNode.GetAddr() {
+					t.Fatalf("weights %v,key %d moved from %s to old node %s", weights, i, before[i], after[i])
+				}
+			}
+		}
+		//ideal share of the new node is 100/total of keys
+		if moved == 0 || moved > keys*2*100/total {
+			t.Fatalf("weights %v,moved %d of %d keys", weights, moved, keys)
+		}
+	}
+}
+
+func TestHashRingRemoveNode(t *testing.T) {
+
+	keys := 20000
+	nodeList := newTestNodes(10, 100)
+	before := ringOwners(newHashRing(nodeList), keys)
+	removed := nodeList[3].GetAddr()
+	after := ringOwners(newHashRing(append(append([]*Node{}, nodeList[:3]...), nodeList[4:]...)), keys)
+
+	for i := 0; i < keys; i++ {
+		if before[i] != removed && before[i] != after[i] {
+			t.Fatalf("key %d moved from %s to %s", i, before[i], after[i])
+		}
+	}
+}
+
+func TestHashRingWeight(t *testing.T) {
+
+	keys := 20000
+	nodeList := newTestNodes(2, 100)
+	nodeList[1].Weight = 300
+
+	counts := make(map[string]int)
+	for _, owner := range ringOwners(newHashRing(nodeList), keys) {
+		counts[owner]++
+	}
+	heavy := counts[nodeList[1].GetAddr()]
+	if heavy < keys*6/10 || heavy > keys*9/10 {
+		t.Fatalf("heavy node got %d of %d keys", heavy, keys)
+	}
+}
@@ -0,0 +1,143 @@
+package easycall
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	HEDGE_PERCENTILE     = 0.95
+	HEDGE_MIN_DELAY      = 5 * time.Millisecond
+	HEDGE_BUDGET_PERCENT = 10
+	HEDGE_MAX_TOKENS     = 10   //max hedges sent in a burst
+	HEDGE_WINDOW_SIZE    = 1000 //latency samples kept per method
+	HEDGE_MIN_SAMPLES    = 20   //samples needed before observed delay is used
+	HEDGE_REFRESH_COUNT  = 100  //observed delay is recomputed every HEDGE_REFRESH_COUNT samples
+)
+
+//HedgePolicy sends a copy of a request to another node if no reply arrives within the hedge delay,
+//the first successful response wins,only idempotent methods should be hedged
+type HedgePolicy struct {
+	Delay         time.Duration //fixed hedge delay,0 means Percentile of observed latency
+	Percentile    float64       //percentile of observed latency used as hedge delay
+	MinDelay      time.Duration //min observed hedge delay
+	BudgetPercent int           //max hedges in percent of hedged method requests
+	methods       map[string]bool
+}
+
+//methods idempotent methods to hedge
+func NewHedgePolicy(methods ...string) *HedgePolicy {
+	policy := &HedgePolicy{
+		Percentile:    HEDGE_PERCENTILE,
+		MinDelay:      HEDGE_MIN_DELAY,
+		BudgetPercent: HEDGE_BUDGET_PERCENT,
+		methods:       make(map[string]bool, 0),
+	}
+	for _, method := range methods {
+		policy.methods[method] = true
+	}
+	return policy
+}
+
+func (hp *HedgePolicy) SetDelay(delay time.Duration) *HedgePolicy {
+	hp.Delay = delay
+	return hp
+}
+
+func (hp *HedgePolicy) SetPercentile(percentile float64) *HedgePolicy {
+	hp.Percentile = percentile
+	return hp
+}
+
+func (hp *HedgePolicy) SetBudgetPercent(percent int) *HedgePolicy {
+	hp.BudgetPercent = percent
+	return hp
+}
+
+//recent latency of a method
+type latencyWindow struct {
+	samples []time.Duration
+	index   int
+	count   int
+	delay   time.Duration
+}
+
+func (lw *latencyWindow) observe(spend time.Duration, percentile float64) {
+	if len(lw.samples) < HEDGE_WINDOW_SIZE {
+		lw.samples = append(lw.samples, spend)
+	} else {
+		lw.samples[lw.index] = spend
+		lw.index = (lw.index + 1) % HEDGE_WINDOW_SIZE
+	}
+	lw.count++
+	if len(lw.samples) >= HEDGE_MIN_SAMPLES && (lw.delay == 0 || lw.count%HEDGE_REFRESH_COUNT == 0) {
+		sorted := make([]time.Duration, len(lw.samples))
+		copy(sorted, lw.samples)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		lw.delay = sorted[int(float64(len(sorted)-1)*percentile)]
+	}
+}
+
+type hedger struct {
+	policy  *HedgePolicy
+	mutex   *sync.Mutex
+	tokens  float64
+	windows map[string]*latencyWindow
+}
+
+func newHedger(policy *HedgePolicy) *hedger {
+	return &hedger{policy: policy, mutex: &sync.Mutex{}, windows: make(map[string]*latencyWindow, 0)}
+}
+
+func (h *hedger) hedged(method string) bool {
+	return h.policy.methods[method]
+}
+
+//hedge delay of method,0 means not hedged until enough latency is observed
+func (h *hedger) delay(method string) time.Duration {
+	if h.policy.Delay > 0 {
+		return h.policy.Delay
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	window := h.windows[method]
+	if window == nil || window.delay == 0 {
+		return 0
+	}
+	if window.delay < h.policy.MinDelay {
+		return h.policy.MinDelay
+	}
+	return window.delay
+}
+
+func (h *hedger) observe(method string, spend time.Duration) {
+	h.mutex.Lock()
+	window := h.windows[method]
+	if window == nil {
+		window = &latencyWindow{samples: make([]time.Duration, 0)}
+		h.windows[method] = window
+	}
+	window.observe(spend, h.policy.Percentile)
+	h.mutex.Unlock()
+}
+
+//every request earns BudgetPercent/100 token,a hedge costs one
+func (h *hedger) deposit() {
+	h.mutex.Lock()
+	h.tokens += float64(h.policy.BudgetPercent) / 100
+	if h.tokens > HEDGE_MAX_TOKENS {
+		h.tokens = HEDGE_MAX_TOKENS
+	}
+	h.mutex.Unlock()
+}
+
+func (h *hedger) withdraw() bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.tokens < 1 {
+		return false
+	}
+	h.tokens--
+	return true
+}
@@ -0,0 +1,124 @@
+package easycall
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testService struct {
+	delay time.Duration
+	port  int
+}
+
+func (s *testService) GetProfile(req *Request, resp *Response) {
+	time.Sleep(s.delay)
+	resp.SetBody(map[string]interface{}{"port": s.port})
+}
+
+//start services on free ports and return their nodes
+func startTestServices(t *testing.T, delays ...time.Duration) []*Node {
+	nodeList := make([]*Node, 0, len(delays))
+	for i, port := range newClosedPorts(t, len(delays)) {
+		server := &Server{}
+		err := server.CreateServer(port, NewServiceHandler(&testService{delays[i], port}, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		nodeList = append(nodeList, &Node{Ip: "127.0.0.1", Port: port, Weight: 100})
+	}
+	return nodeList
+}
+
+//port in a testService response,msgpack decodes numbers to int or uint kinds and json to float64
+func respPort(resp map[string]interface{}) int {
+	v := reflect.ValueOf(resp["port"])
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return int(v.Float())
+	}
+	return 0
+}
+
+func TestHedgeRequest(t *testing.T) {
+
+	nodeList := startTestServices(t, time.Millisecond*500, 0)
+	registry := NewStaticRegistry(map[string][]*Node{"profile": nodeList})
+
+	policy := NewHedgePolicy("GetProfile").SetDelay(time.Millisecond * 20).SetBudgetPercent(100)
+	client := NewServiceClientWithRegistry(registry, "profile", 10, LB_ROUND_ROBIN, WithHedgePolicy(policy))
+
+	for i := 0; i < 4; i++ {
+		startTime := time.Now()
+		resp := make(map[string]interface{})
+		err := client.Request("GetProfile", map[string]interface{}{}, &resp, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if respPort(resp) != nodeList[1].Port || time.Since(startTime) > time.Millisecond*300 {
+			t.Fatalf("slow node not hedged,resp=%v,spend=%v", resp, time.Since(startTime))
+		}
+	}
+}
+
+func TestHedgeBudget(t *testing.T) {
+
+	h := newHedger(NewHedgePolicy("GetProfile").SetBudgetPercent(10))
+	hedges := 0
+	for i := 0; i < 100; i++ {
+		h.deposit()
+		if h.withdraw() {
+			hedges++
+		}
+	}
+	if hedges > 10 {
+		t.Fatalf("hedges exceed budget,%d", hedges)
+	}
+
+	for i := 1; i <= 100; i++ {
+		h.observe("GetProfile", time.Millisecond*time.Duration(i))
+	}
+	if h.delay("GetProfile") != time.Millisecond*95 {
+		t.Fatalf("unexpected hedge delay %v", h.delay("GetProfile"))
+	}
+}
+
+func TestHedgeWithOutlierProbe(t *testing.T) {
+
+	nodeList := startTestServices(t, time.Millisecond*300, 0)
+	registry := NewStaticRegistry(map[string][]*Node{"profile": nodeList})
+
+	outlier := NewOutlierPolicy()
+	outlier.ConsecutiveErrors = 1
+	outlier.BaseEjectionTime = time.Millisecond * 50
+	hedge := NewHedgePolicy("GetProfile").SetDelay(time.Millisecond * 20).SetBudgetPercent(100)
+	client := NewServiceClientWithRegistry(registry, "profile", 10, LB_ROUND_ROBIN, WithOutlierDetection(outlier), WithHedgePolicy(hedge))
+
+	resp := make(map[string]interface{})
+	err := client.Request("GetProfile", map[string]interface{}{}, &resp, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slow := nodeList[0]
+	client.outlier.report(slow, NewSystemError(ERROR_TIME_OUT, "request time out"))
+	time.Sleep(time.Millisecond * 60)
+
+	//probes of the slow node lose to hedges,they must not keep it ejected
+	for i := 0; i < 4; i++ {
+		err := client.Request("GetProfile", map[string]interface{}{}, &resp, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	client.outlier.mutex.Lock()
+	health := client.outlier.healths[slow.GetAddr()]
+	probing, ejected := health.probing, health.ejected(time.Now())
+	client.outlier.mutex.Unlock()
+	if probing || ejected {
+		t.Fatalf("slow node pinned after lost probes,probing=%v,ejected=%v", probing, ejected)
+	}
+}
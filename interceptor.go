@@ -0,0 +1,66 @@
+package easycall
+
+import "time"
+
+type InterceptorFunc func(inv *Invocation, next *InterceptorInfo) error
+
+type InterceptorInfo struct {
+	Interceptor InterceptorFunc
+	Next        *InterceptorInfo
+}
+
+//Invocation of a request through client interceptors,node and resp are set once next interceptor returns
+type Invocation struct {
+	format  byte          //request package format 0 for MSGPACK,1 for Json
+	head    *EasyHead     //request head
+	body    interface{}   //request body
+	timeout time.Duration //request timeout
+	node    *Node         //node responding the request
+	resp    *EasyPackage  //response package,nil when request fails before response
+	target  *Node         //node the request must be sent to,e.g. broadcast,nil for load balance
+}
+
+func (inv *Invocation) GetFormat() byte {
+	return inv.format
+}
+
+func (inv *Invocation) GetHead() *EasyHead {
+	return inv.head
+}
+
+func (inv *Invocation) GetBody() interface{} {
+	return inv.body
+}
+
+func (inv *Invocation) SetBody(body interface{}) *Invocation {
+	inv.body = body
+	return inv
+}
+
+func (inv *Invocation) GetTimeout() time.Duration {
+	return inv.timeout
+}
+
+func (inv *Invocation) SetTimeout(timeout time.Duration) *Invocation {
+	inv.timeout = timeout
+	return inv
+}
+
+func (inv *Invocation) GetNode() *Node {
+	return inv.node
+}
+
+//node the request must be sent to,nil for load balance
+func (inv *Invocation) GetTarget() *Node {
+	return inv.target
+}
+
+func (inv *Invocation) GetResp() *EasyPackage {
+	return inv.resp
+}
+
+//replace the response,e.g. a fallback response
+func (inv *Invocation) SetResp(resp *EasyPackage) *Invocation {
+	inv.resp = resp
+	return inv
+}
@@ -0,0 +1,89 @@
+package easycall
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInterceptor(t *testing.T) {
+
+	nodeList := startTestServices(t, 0)
+	registry := NewStaticRegistry(map[string][]*Node{"profile": nodeList})
+	client := NewEasyClientWithRegistry(registry, 10, LB_ROUND_ROBIN)
+
+	calls := make([]string, 0)
+	var node *Node
+	client.AddInterceptor(func(inv *Invocation, next *InterceptorInfo) error {
+		calls = append(calls, "trace")
+		inv.GetHead().SetTraceId("trace-1")
+		err := next.Interceptor(inv, next.Next)
+		node = inv.GetNode()
+		return err
+	})
+	client.AddInterceptor(func(inv *Invocation, next *InterceptorInfo) error {
+		calls = append(calls, "auth")
+		if inv.GetHead().GetTraceId() != "trace-1" {
+			t.Fatal("head not changed by previous interceptor")
+		}
+		return next.Interceptor(inv, next.Next)
+	})
+
+	resp := make(map[string]interface{})
+	err := client.Request("profile", "GetProfile", map[string]interface{}{}, &resp, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 2 || calls[0] != "trace" || calls[1] != "auth" {
+		t.Fatalf("unexpected interceptor calls:%v", calls)
+	}
+	if node == nil || node.Port != nodeList[0].Port {
+		t.Fatalf("unexpected node:%v", node)
+	}
+
+	//async requests run through interceptors too
+	respChan, err := client.RequestAsync("profile", "GetProfile", map[string]interface{}{}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	respPkg := <-respChan
+	if respPkg == nil || respPkg.GetHead().GetRet() != 0 || len(calls) != 4 || calls[2] != "trace" {
+		t.Fatalf("async request not intercepted,calls:%v", calls)
+	}
+
+	//short circuit
+	client.AddInterceptor(func(inv *Invocation, next *InterceptorInfo) error {
+		return NewLogicError(3001, "denied")
+	})
+	err = client.Request("profile", "GetProfile", map[string]interface{}{}, &resp, time.Second)
+	if logicErr, ok := err.(*LogicError); !ok || logicErr.GetRet() != 3001 {
+		t.Fatalf("unexpected error:%v", err)
+	}
+	respChan, _ = client.RequestAsync("profile", "GetProfile", map[string]interface{}{}, time.Second)
+	respPkg = <-respChan
+	if respPkg == nil || respPkg.GetHead().GetRet() != 3001 {
+		t.Fatalf("unexpected async response:%v", respPkg)
+	}
+	//service not found is returned at once
+	_, err = client.RequestAsync("order", "GetOrder", map[string]interface{}{}, time.Second)
+	if sysErr, ok := err.(*SystemError); !ok || sysErr.GetRet() != ERROR_SERVICE_NOT_FOUND {
+		t.Fatalf("unexpected async error:%v", err)
+	}
+}
+
+func TestInterceptorPanic(t *testing.T) {
+
+	nodeList := startTestServices(t, 0)
+	client := NewStaticEasyClient(map[string][]*Node{"profile": nodeList}, 10, LB_ROUND_ROBIN)
+	client.AddInterceptor(func(inv *Invocation, next *InterceptorInfo) error {
+		panic("interceptor panics")
+	})
+
+	respChan, err := client.RequestAsync("profile", "GetProfile", map[string]interface{}{}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	respPkg := <-respChan
+	if respPkg == nil || respPkg.GetHead().GetRet() != ERROR_INTERNAL_ERROR {
+		t.Fatalf("panic not received as error package:%v", respPkg)
+	}
+}
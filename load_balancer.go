@@ -4,6 +4,8 @@ import (
 	"errors"
 	"hash/crc32"
 	"math/rand"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -13,73 +15,115 @@ const (
 	LB_HASH          = 3
 	LB_ROUND_ROBIN   = 4
 	LB_RANDOM_WEIGHT = 5
+	LB_LATENCY       = 6 //power of two choices by peak ewma latency
+	LB_SMOOTH_WEIGHT = 7 //nginx style smooth weighted round robin
 )
 
-type LoadBalancer struct {
-	nodeList []*Node
-	seq      int64
-}
+var errNoNode = errors.New("service not found")
 
-func NewLoadBalancer() *LoadBalancer {
-	lb := &LoadBalancer{}
-	return lb
+type roundRobinBalancer struct {
+	seq int64
 }
 
-func (lb *LoadBalancer) SetNodes(nodeList []*Node) {
-	lb.nodeList = nodeList
+func (b *roundRobinBalancer) Update(nodeList []*Node) {
 }
 
-func (lb *LoadBalancer) GetNode(loadBalanceType int, routeKey string) (*Node, error) {
-
-	var node *Node = nil
-	if len(lb.nodeList) == 0 {
-		return nil, errors.New("service not found")
+func (b *roundRobinBalancer) Pick(nodeList []*Node, head *EasyHead) (*Node, error) {
+	if len(nodeList) == 0 {
+		return nil, errNoNode
 	}
+	seq := atomic.AddInt64(&b.seq, 1)
+	index := int(seq % int64(len(nodeList)))
+	return nodeList[index], nil
+}
 
-	if loadBalanceType == LB_ACTIVE {
-		node = lb.getNodeByLoadBalanceActive()
-	} else if loadBalanceType == LB_RANDOM {
-		node = lb.getNodeByLoadBalanceRandom()
-	} else if loadBalanceType == LB_RANDOM_WEIGHT {
-		node = lb.getNodeByLoadBalanceRandomWeight()
-	} else if loadBalanceType == LB_ROUND_ROBIN {
-		node = lb.getNodeByLoadBalanceRoundRobin()
-	} else if loadBalanceType == LB_HASH {
-		node = lb.getNodeByLoadBalanceHash(routeKey)
-	} else {
-		return nil, errors.New("invalid loadBalanceType")
-	}
-	return node, nil
+func (b *roundRobinBalancer) Report(node *Node, spend time.Duration, err error) {
+}
+
+type activeBalancer struct {
+	roundRobinBalancer
 }
 
-func (lb *LoadBalancer) getNodeByLoadBalanceActive() *Node {
+func (b *activeBalancer) Pick(nodeList []*Node, head *EasyHead) (*Node, error) {
 
-	len := len(lb.nodeList)
+	len := len(nodeList)
+	if len == 0 {
+		return nil, errNoNode
+	}
 	index := 0
-	active := lb.nodeList[0].Active
+	active := atomic.LoadInt32(&nodeList[0].Active)
 	for i := 1; i < len; i++ {
-		if active >= lb.nodeList[i].Active {
-			active = lb.nodeList[i].Active
+		nodeActive := atomic.LoadInt32(&nodeList[i].Active)
+		if active >= nodeActive {
+			active = nodeActive
 			index = i
 		}
 	}
 
 	if index == (len - 1) {
-		return lb.getNodeByLoadBalanceRoundRobin()
+		return b.roundRobinBalancer.Pick(nodeList, head)
 	}
 
-	return lb.nodeList[index]
+	return nodeList[index], nil
+}
+
+type randomBalancer struct {
 }
 
-func (lb *LoadBalancer) getNodeByLoadBalanceRandom() *Node {
+func (b *randomBalancer) Update(nodeList []*Node) {
+}
 
-	len := len(lb.nodeList)
-	rand.Seed(time.Now().UnixNano())
-	index := rand.Intn(len)
-	return lb.nodeList[index]
+func (b *randomBalancer) Pick(nodeList []*Node, head *EasyHead) (*Node, error) {
+	if len(nodeList) == 0 {
+		return nil, errNoNode
+	}
+	return nodeList[rand.Intn(len(nodeList))], nil
 }
 
-func (lb *LoadBalancer) hashKey(key string) uint32 {
+func (b *randomBalancer) Report(node *Node, spend time.Duration, err error) {
+}
+
+type randomWeightBalancer struct {
+	randomBalancer
+}
+
+func (b *randomWeightBalancer) Pick(nodeList []*Node, head *EasyHead) (*Node, error) {
+
+	total := 0
+	for _, node := range nodeList {
+		total += node.GetWeight()
+	}
+	if total <= 0 {
+		return b.randomBalancer.Pick(nodeList, head)
+	}
+	random := rand.Intn(total)
+	for _, node := range nodeList {
+		random -= node.GetWeight()
+		if random < 0 {
+			return node, nil
+		}
+	}
+	return nodeList[0], nil
+}
+
+type hashBalancer struct {
+	ring    *hashRing
+	rwmutex *sync.RWMutex
+}
+
+func newHashBalancer() *hashBalancer {
+	return &hashBalancer{ring: newHashRing(nil), rwmutex: &sync.RWMutex{}}
+}
+
+//the hash ring is rebuilt only when nodes change
+func (b *hashBalancer) Update(nodeList []*Node) {
+	ring := newHashRing(nodeList)
+	b.rwmutex.Lock()
+	b.ring = ring
+	b.rwmutex.Unlock()
+}
+
+func (b *hashBalancer) hashKey(key string) uint32 {
 	if len(key) < 64 {
 		var scratch [64]byte
 		copy(scratch[:], key)
@@ -88,35 +132,174 @@ func (lb *LoadBalancer) hashKey(key string) uint32 {
 	return crc32.ChecksumIEEE([]byte(key))
 }
 
-func (lb *LoadBalancer) getNodeByLoadBalanceHash(routeKey string) *Node {
+func (b *hashBalancer) Pick(nodeList []*Node, head *EasyHead) (*Node, error) {
+	if len(nodeList) == 0 {
+		return nil, errNoNode
+	}
+	b.rwmutex.RLock()
+	ring := b.ring
+	b.rwmutex.RUnlock()
 
-	len := len(lb.nodeList)
-	index := lb.hashKey(routeKey) % uint32(len)
-	return lb.nodeList[index]
+	node := ring.pick(b.hashKey(head.GetRouteKey()), nodeList)
+	if node == nil {
+		return nil, errNoNode
+	}
+	return node, nil
 }
 
-func (lb *LoadBalancer) getNodeByLoadBalanceRandomWeight() *Node {
+func (b *hashBalancer) Report(node *Node, spend time.Duration, err error) {
+}
 
-	total := 0
-	for i := 0; i < len(lb.nodeList); i++ {
-		node := lb.nodeList[i]
-		total += node.Weight
+type latencyBalancer struct {
+	latency map[string]*nodeLatency
+	rwmutex *sync.RWMutex
+}
+
+func newLatencyBalancer() *latencyBalancer {
+	return &latencyBalancer{latency: make(map[string]*nodeLatency, 0), rwmutex: &sync.RWMutex{}}
+}
+
+//keep latency of nodes still alive
+func (b *latencyBalancer) Update(nodeList []*Node) {
+	b.rwmutex.Lock()
+	latency := make(map[string]*nodeLatency, len(nodeList))
+	for _, node := range nodeList {
+		addr := node.GetAddr()
+		if b.latency[addr] != nil {
+			latency[addr] = b.latency[addr]
+		} else {
+			latency[addr] = newNodeLatency()
+		}
 	}
-	rand.Seed(time.Now().UnixNano())
-	random := rand.Intn(total)
-	for i := 0; i < len(lb.nodeList); i++ {
-		node := lb.nodeList[i]
-		random -= node.Weight
-		if random <= 0 {
-			return node
+	b.latency = latency
+	b.rwmutex.Unlock()
+}
+
+func (b *latencyBalancer) cost(node *Node) float64 {
+	b.rwmutex.RLock()
+	latency := b.latency[node.GetAddr()]
+	b.rwmutex.RUnlock()
+	if latency == nil {
+		return 0
+	}
+	return latency.cost(atomic.LoadInt32(&node.Active))
+}
+
+func (b *latencyBalancer) Pick(nodeList []*Node, head *EasyHead) (*Node, error) {
+
+	len := len(nodeList)
+	if len == 0 {
+		return nil, errNoNode
+	}
+	if len == 1 {
+		return nodeList[0], nil
+	}
+	//power of two choices,pick the cheaper one of two random nodes
+	i := rand.Intn(len)
+	j := rand.Intn(len - 1)
+	if j >= i {
+		j++
+	}
+	if b.cost(nodeList[j]) < b.cost(nodeList[i]) {
+		return nodeList[j], nil
+	}
+	return nodeList[i], nil
+}
+
+//timeout requests report the whole timeout,failures report at least EWMA_PENALTY
+//so a node failing fast does not draw more traffic
+func (b *latencyBalancer) Report(node *Node, spend time.Duration, err error) {
+	b.rwmutex.RLock()
+	latency := b.latency[node.GetAddr()]
+	b.rwmutex.RUnlock()
+	if latency == nil {
+		return
+	}
+	if isNodeFailure(err) && spend < time.Duration(EWMA_PENALTY) {
+		spend = time.Duration(EWMA_PENALTY)
+	}
+	latency.observe(spend)
+}
+
+type smoothWeightBalancer struct {
+	roundRobinBalancer
+	current map[string]int //current weights of nodes
+	mutex   *sync.Mutex
+}
+
+func newSmoothWeightBalancer() *smoothWeightBalancer {
+	return &smoothWeightBalancer{current: make(map[string]int, 0), mutex: &sync.Mutex{}}
+}
+
+func (b *smoothWeightBalancer) Update(nodeList []*Node) {
+	b.mutex.Lock()
+	b.current = make(map[string]int, len(nodeList))
+	b.mutex.Unlock()
+}
+
+func (b *smoothWeightBalancer) Pick(nodeList []*Node, head *EasyHead) (*Node, error) {
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	var best *Node = nil
+	total := 0
+	for _, node := range nodeList {
+		weight := node.GetWeight()
+		if weight <= 0 {
+			continue
+		}
+		addr := node.GetAddr()
+		b.current[addr] += weight
+		total += weight
+		if best == nil || b.current[addr] > b.current[best.GetAddr()] {
+			best = node
 		}
 	}
-	return lb.nodeList[0]
+	if best == nil {
+		return b.roundRobinBalancer.Pick(nodeList, head)
+	}
+	b.current[best.GetAddr()] -= total
+	return best, nil
+}
+
+//Deprecated: LoadBalancer is kept for compatibility,use NewBalancer instead
+type LoadBalancer struct {
+	nodeList  []*Node
+	balancers map[int]Balancer
+	mutex     *sync.Mutex
+}
+
+//Deprecated: use NewBalancer(GetBalancerName(loadBalanceType)) instead
+func NewLoadBalancer() *LoadBalancer {
+	return &LoadBalancer{balancers: make(map[int]Balancer, 0), mutex: &sync.Mutex{}}
+}
+
+func (lb *LoadBalancer) SetNodes(nodeList []*Node) {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+	lb.nodeList = nodeList
+	for _, balancer := range lb.balancers {
+		balancer.Update(nodeList)
+	}
 }
 
-func (lb *LoadBalancer) getNodeByLoadBalanceRoundRobin() *Node {
-	lb.seq++
-	len := len(lb.nodeList)
-	index := int(lb.seq % int64(len))
-	return lb.nodeList[index]
+func (lb *LoadBalancer) GetNode(loadBalanceType int, routeKey string) (*Node, error) {
+
+	lb.mutex.Lock()
+	nodeList := lb.nodeList
+	balancer := lb.balancers[loadBalanceType]
+	if balancer == nil {
+		var err error
+		balancer, err = NewBalancer(GetBalancerName(loadBalanceType))
+		if err != nil {
+			lb.mutex.Unlock()
+			return nil, errors.New("invalid loadBalanceType")
+		}
+		balancer.Update(nodeList)
+		lb.balancers[loadBalanceType] = balancer
+	}
+	lb.mutex.Unlock()
+
+	return balancer.Pick(nodeList, NewEasyHead().SetRouteKey(routeKey))
 }
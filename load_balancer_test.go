@@ -0,0 +1,163 @@
+package easycall
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestBalancer(t *testing.T, name string, nodeList []*Node) Balancer {
+	balancer, err := NewBalancer(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	balancer.Update(nodeList)
+	return balancer
+}
+
+func TestLatencyBalancer(t *testing.T) {
+
+	nodeList := newTestNodes(2, 100)
+	balancer := newTestBalancer(t, BALANCER_LATENCY, nodeList)
+
+	balancer.Report(nodeList[0], time.Millisecond*200, nil)
+	balancer.Report(nodeList[1], time.Millisecond*5, nil)
+
+	for i := 0; i < 100; i++ {
+		node, err := balancer.Pick(nodeList, NewEasyHead())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if node != nodeList[1] {
+			t.Fatalf("slow node %s picked", node.GetAddr())
+		}
+	}
+
+	//the fast node gets busy,traffic moves to the slow one
+	nodeList[1].Active = 100
+	node, _ := balancer.Pick(nodeList, NewEasyHead())
+	if node != nodeList[0] {
+		t.Fatalf("busy node %s picked", node.GetAddr())
+	}
+
+	//the fast node fails fast,traffic moves to the slow one
+	nodeList[1].Active = 0
+	balancer.Report(nodeList[1], time.Millisecond, NewSystemError(ERROR_SERVICE_BUSY, "busy"))
+	node, _ = balancer.Pick(nodeList, NewEasyHead())
+	if node != nodeList[0] {
+		t.Fatalf("failing node %s picked", node.GetAddr())
+	}
+}
+
+func TestSmoothWeightBalancer(t *testing.T) {
+
+	nodeList := newTestNodes(3, 1)
+	nodeList[0].Weight = 5
+	balancer := newTestBalancer(t, BALANCER_SMOOTH_WEIGHT, nodeList)
+
+	expect := []int{0, 0, 1, 0, 2, 0, 0}
+	for round := 0; round < 3; round++ {
+		for i, index := range expect {
+			node, err := balancer.Pick(nodeList, NewEasyHead())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if node != nodeList[index] {
+				t.Fatalf("round %d pick %d expect %s got %s", round, i, nodeList[index].GetAddr(), node.GetAddr())
+			}
+		}
+	}
+}
+
+func TestHashBalancerCandidates(t *testing.T) {
+
+	nodeList := newTestNodes(5, 100)
+	balancer := newTestBalancer(t, BALANCER_HASH, nodeList)
+
+	head := NewEasyHead().SetRouteKey("10001")
+	node, _ := balancer.Pick(nodeList, head)
+
+	candidates := make([]*Node, 0)
+	for _, n := range nodeList {
+		if n != node {
+			candidates = append(candidates, n)
+		}
+	}
+	other, err := balancer.Pick(candidates, head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == node {
+		t.Fatalf("node %s not in candidates picked", node.GetAddr())
+	}
+}
+
+type firstBalancer struct {
+}
+
+func (b *firstBalancer) Update(nodeList []*Node) {
+}
+
+func (b *firstBalancer) Pick(nodeList []*Node, head *EasyHead) (*Node, error) {
+	return nodeList[0], nil
+}
+
+func (b *firstBalancer) Report(node *Node, spend time.Duration, err error) {
+}
+
+func TestRegisterBalancer(t *testing.T) {
+
+	RegisterBalancer("first", func() Balancer { return &firstBalancer{} })
+	nodeList := newTestNodes(3, 100)
+	balancer := newTestBalancer(t, "first", nodeList)
+	node, _ := balancer.Pick(nodeList, NewEasyHead())
+	if node != nodeList[0] {
+		t.Fatalf("unexpected node %s", node.GetAddr())
+	}
+
+	if _, err := NewBalancer("unknown"); err == nil {
+		t.Fatal("expect error for unknown balancer")
+	}
+}
+
+func TestSlowStartWeight(t *testing.T) {
+
+	node := &Node{Ip: "127.0.0.1", Port: 8001, Weight: 100, warmup: time.Minute}
+	if node.GetWeight() != 100 {
+		t.Fatalf("node with unknown start time got weight %d", node.GetWeight())
+	}
+
+	node.StartTime = GetTimeNow()
+	if node.GetWeight() != 10 {
+		t.Fatalf("node just started got weight %d", node.GetWeight())
+	}
+
+	node.StartTime = GetTimeNow() - 30*1000
+	if weight := node.GetWeight(); weight < 49 || weight > 51 {
+		t.Fatalf("node half warmed up got weight %d", weight)
+	}
+
+	node.StartTime = GetTimeNow() - 120*1000
+	if node.GetWeight() != 100 {
+		t.Fatalf("node warmed up got weight %d", node.GetWeight())
+	}
+}
+
+func TestLoadBalancerCompat(t *testing.T) {
+
+	lb := NewLoadBalancer()
+	nodeList := newTestNodes(3, 100)
+	lb.SetNodes(nodeList)
+
+	node, err := lb.GetNode(LB_HASH, "uid1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if other, _ := lb.GetNode(LB_HASH, "uid1"); other != node {
+			t.Fatalf("hash picked %s and %s", node.GetAddr(), other.GetAddr())
+		}
+	}
+	if _, err := lb.GetNode(0, ""); err == nil {
+		t.Fatal("invalid loadBalanceType accepted")
+	}
+}
@@ -0,0 +1,41 @@
+package easycall
+
+import (
+	"sync/atomic"
+)
+
+//LocalityPolicy prefers nodes in the caller's zone,zone of a node comes from its META_ZONE metadata
+type LocalityPolicy struct {
+	Zone      string //caller's zone
+	MinNodes  int    //spill over to other zones when local nodes are fewer than MinNodes
+	MaxActive int32  //spill over when average active requests of local nodes exceed MaxActive,0 means no limit
+}
+
+//choose local nodes from candidates,all candidates are returned when spilling over
+func (lp *LocalityPolicy) filter(nodeList []*Node) []*Node {
+
+	if lp.Zone == "" {
+		return nodeList
+	}
+
+	local := make([]*Node, 0, len(nodeList))
+	var active int32 = 0
+	for _, node := range nodeList {
+		if node.GetZone() == lp.Zone {
+			local = append(local, node)
+			active += atomic.LoadInt32(&node.Active)
+		}
+	}
+
+	minNodes := lp.MinNodes
+	if minNodes < 1 {
+		minNodes = 1
+	}
+	if len(local) < minNodes {
+		return nodeList
+	}
+	if lp.MaxActive > 0 && active/int32(len(local)) > lp.MaxActive {
+		return nodeList
+	}
+	return local
+}
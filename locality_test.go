@@ -0,0 +1,50 @@
+package easycall
+
+import (
+	"testing"
+)
+
+func newZoneNodes() []*Node {
+	nodeList := newTestNodes(4, 100)
+	for i, node := range nodeList {
+		if i < 2 {
+			node.Meta = map[string]string{META_ZONE: "az1"}
+		} else {
+			node.Meta = map[string]string{META_ZONE: "az2"}
+		}
+	}
+	return nodeList
+}
+
+func TestLocalityPreferLocal(t *testing.T) {
+
+	policy := &LocalityPolicy{Zone: "az1", MinNodes: 2}
+	candidates := policy.filter(newZoneNodes())
+	if len(candidates) != 2 {
+		t.Fatalf("expect 2 local nodes,got %d", len(candidates))
+	}
+	for _, node := range candidates {
+		if node.GetZone() != "az1" {
+			t.Fatalf("node %s of zone %s chosen", node.GetAddr(), node.GetZone())
+		}
+	}
+}
+
+func TestLocalitySpillOver(t *testing.T) {
+
+	nodeList := newZoneNodes()
+	policy := &LocalityPolicy{Zone: "az1", MinNodes: 2}
+
+	//a local node is gone
+	if candidates := policy.filter(nodeList[1:]); len(candidates) != 3 {
+		t.Fatalf("expect spill over to 3 nodes,got %d", len(candidates))
+	}
+
+	//local nodes are overloaded
+	policy.MaxActive = 10
+	nodeList[0].Active = 15
+	nodeList[1].Active = 15
+	if candidates := policy.filter(nodeList); len(candidates) != 4 {
+		t.Fatalf("expect spill over to 4 nodes,got %d", len(candidates))
+	}
+}
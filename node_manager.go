@@ -1,57 +1,140 @@
 package easycall
 
 import (
-	"context"
-	"encoding/json"
 	"errors"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/coreos/etcd/clientv3"
 	"github.com/starjiang/elog"
 )
 
 const (
 	ZK_NOT_EXSIT_NODE_CACHE_TIME = 5000
+	META_VERSION                 = "version"
+	META_ZONE                    = "zone"
+	META_TAGS                    = "tags" //comma separated tags like canary
+	SLOW_START_MIN_FACTOR        = 0.1    //weight factor of a node just started
 )
 
 type NodeManager struct {
 	exsit       int64
 	mutex       *sync.Mutex
-	cli         *clientv3.Client
+	registry    Registry
 	serviceName string
 	nodeList    []*Node
-	timeout     time.Duration
 	watched     bool
+	listeners   []WatchFunc
 }
 
 type Node struct {
-	Ip     string `json:"ip"`
-	Port   int    `json:"port"`
-	Weight int    `json:"weight"`
-	Active int32
+	Ip        string            `json:"ip"`
+	Port      int               `json:"port"`
+	Weight    int               `json:"weight"`
+	Meta      map[string]string `json:"meta,omitempty"` //metadata registered by service,like version,zone and tags
+	StartTime int64             `json:"startTime"`      //register time in milliseconds,0 means unknown
+	Active    int32             `json:"-"`
+	warmup    time.Duration     //slow start window of the client
 }
 
+func (node *Node) GetAddr() string {
+	return node.Ip + ":" + strconv.Itoa(node.Port)
+}
+
+//effective weight,it ramps from a small value up to Weight during warmup window after the node started
+func (node *Node) GetWeight() int {
+	if node.warmup <= 0 || node.StartTime <= 0 || node.Weight <= 0 {
+		return node.Weight
+	}
+	elapsed := time.Duration(GetTimeNow()-node.StartTime) * time.Millisecond
+	if elapsed >= node.warmup {
+		return node.Weight
+	}
+	factor := float64(elapsed) / float64(node.warmup)
+	if factor < SLOW_START_MIN_FACTOR {
+		factor = SLOW_START_MIN_FACTOR
+	}
+	weight := int(float64(node.Weight) * factor)
+	if weight < 1 {
+		weight = 1
+	}
+	return weight
+}
+
+func (node *Node) GetMeta(key string) string {
+	return node.Meta[key]
+}
+
+func (node *Node) GetVersion() string {
+	return node.Meta[META_VERSION]
+}
+
+func (node *Node) GetZone() string {
+	return node.Meta[META_ZONE]
+}
+
+func (node *Node) GetTags() []string {
+	tags := make([]string, 0)
+	for _, tag := range strings.Split(node.Meta[META_TAGS], ",") {
+		tag = strings.TrimSpace(tag)
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+//selector "key=value" matches metadata,otherwise it matches a tag
+func (node *Node) Match(selector string) bool {
+	index := strings.Index(selector, "=")
+	if index > 0 {
+		return node.GetMeta(strings.TrimSpace(selector[:index])) == strings.TrimSpace(selector[index+1:])
+	}
+	return node.HasTag(strings.TrimSpace(selector))
+}
+
+func (node *Node) HasTag(tag string) bool {
+	for _, t := range node.GetTags() {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+//endpoints etcd endpoints list
+//serviceName microservice name
+//timeout etcd connect timeout
 func NewNodeManager(endpoints []string, serviceName string, timeout time.Duration) (*NodeManager, error) {
-	nodeManager := &NodeManager{}
-	cli, err := clientv3.New(clientv3.Config{
-		Endpoints:   endpoints,
-		DialTimeout: timeout,
-	})
+	registry, err := NewEtcdRegistry(endpoints, timeout)
 	if err != nil {
 		return nil, err
 	}
+	return NewNodeManagerWithRegistry(registry, serviceName), nil
+}
 
-	nodeManager.cli = cli
+//registry where service nodes are discovered
+//serviceName microservice name
+func NewNodeManagerWithRegistry(registry Registry, serviceName string) *NodeManager {
+	nodeManager := &NodeManager{}
+	nodeManager.registry = registry
 	nodeManager.serviceName = serviceName
 	nodeManager.mutex = &sync.Mutex{}
-	nodeManager.timeout = timeout
-	return nodeManager, nil
+	return nodeManager
 }
 
-func (nm *NodeManager) getNodes() ([]*Node, error) {
+//listener is called with the new node list every time nodes are loaded or changed
+func (nm *NodeManager) addListener(listener WatchFunc) {
+	nm.mutex.Lock()
+	nm.listeners = append(nm.listeners, listener)
+	if nm.nodeList != nil {
+		listener(nm.nodeList)
+	}
+	nm.mutex.Unlock()
+}
 
-	path := EASYCALL_ETCD_SERVICE_PATH + "/" + nm.serviceName + "/nodes"
+func (nm *NodeManager) getNodes() ([]*Node, error) {
 
 	nm.mutex.Lock()
 	defer nm.mutex.Unlock()
@@ -61,12 +144,11 @@ func (nm *NodeManager) getNodes() ([]*Node, error) {
 		if nm.exsit+ZK_NOT_EXSIT_NODE_CACHE_TIME > timeNow {
 			return nil, errors.New("zk node not exsit")
 		}
-		err := nm.loadServiceNode(path)
+		err := nm.loadServiceNode()
 		if nm.nodeList == nil {
 			nm.exsit = GetTimeNow()
 			return nil, err
 		}
-		return nm.nodeList, nil
 	}
 	if len(nm.nodeList) == 0 {
 		return nil, errors.New("service " + nm.serviceName + " not found")
@@ -74,45 +156,37 @@ func (nm *NodeManager) getNodes() ([]*Node, error) {
 	return nm.nodeList, nil
 }
 
-func (nm *NodeManager) loadServiceNode(path string) error {
-
-	ctx, cancel := context.WithTimeout(context.Background(), nm.timeout)
-	resp, err := nm.cli.Get(ctx, path, clientv3.WithPrefix())
-	cancel()
+func (nm *NodeManager) loadServiceNode() error {
 
+	nodeList, err := nm.registry.List(nm.serviceName)
 	if err != nil {
 		return err
 	}
 
 	if nm.watched == false {
-		nm.watched = true
-		//children changed reload
-		go func() {
-			for {
-				//watch
-				rch := nm.cli.Watch(context.Background(), path, clientv3.WithPrefix())
-				for _ = range rch {
-					elog.Info(path, "node reload")
-					nm.loadServiceNode(path)
-				}
-				elog.Error(path, "watch failed")
-			}
-		}()
-	}
-
-	nodeList := make([]*Node, 0)
-
-	for _, ev := range resp.Kvs {
-
-		node := &Node{}
-		err = json.Unmarshal(ev.Value, node)
+		err = nm.registry.Watch(nm.serviceName, nm.onNodesChanged)
 		if err != nil {
-			elog.Error("decode child data fail:", err)
-			continue
+			elog.Error(nm.serviceName, "watch nodes fail:", err)
+		} else {
+			nm.watched = true
 		}
-		nodeList = append(nodeList, node)
 	}
-	nm.nodeList = nodeList
 
+	nm.setNodes(nodeList)
 	return nil
 }
+
+func (nm *NodeManager) onNodesChanged(nodeList []*Node) {
+	elog.Info(nm.serviceName, "node reload")
+	nm.mutex.Lock()
+	nm.setNodes(nodeList)
+	nm.mutex.Unlock()
+}
+
+//must be called with mutex held
+func (nm *NodeManager) setNodes(nodeList []*Node) {
+	nm.nodeList = nodeList
+	for _, listener := range nm.listeners {
+		listener(nodeList)
+	}
+}
@@ -0,0 +1,235 @@
+package easycall
+
+import (
+	"sync"
+	"time"
+
+	"github.com/starjiang/elog"
+)
+
+const (
+	OUTLIER_CONSECUTIVE_ERRORS   = 5
+	OUTLIER_ERROR_RATE           = 0.5
+	OUTLIER_MIN_REQUESTS         = 20
+	OUTLIER_INTERVAL             = 10 * time.Second
+	OUTLIER_BASE_EJECTION_TIME   = 30 * time.Second
+	OUTLIER_MAX_EJECTION_TIME    = 300 * time.Second
+	OUTLIER_MAX_EJECTION_PERCENT = 50
+)
+
+//OutlierPolicy ejects nodes failing with system errors or timeouts from selection for a while
+type OutlierPolicy struct {
+	ConsecutiveErrors  int           //eject after consecutive failures,0 disables it
+	ErrorRate          float64       //eject when failure rate within Interval exceeds it,0 disables it
+	MinRequests        int           //requests needed within Interval before ErrorRate applies
+	Interval           time.Duration //statistic window of ErrorRate
+	BaseEjectionTime   time.Duration //ejection time of the first ejection,it doubles on every ejection in a row
+	MaxEjectionTime    time.Duration //max ejection time
+	MaxEjectionPercent int           //max percent of nodes ejected at the same time
+}
+
+func NewOutlierPolicy() *OutlierPolicy {
+	return &OutlierPolicy{
+		ConsecutiveErrors:  OUTLIER_CONSECUTIVE_ERRORS,
+		ErrorRate:          OUTLIER_ERROR_RATE,
+		MinRequests:        OUTLIER_MIN_REQUESTS,
+		Interval:           OUTLIER_INTERVAL,
+		BaseEjectionTime:   OUTLIER_BASE_EJECTION_TIME,
+		MaxEjectionTime:    OUTLIER_MAX_EJECTION_TIME,
+		MaxEjectionPercent: OUTLIER_MAX_EJECTION_PERCENT,
+	}
+}
+
+type nodeHealth struct {
+	consecutive   int
+	total         int
+	errors        int
+	windowStart   time.Time
+	ejectCount    int       //ejections in a row
+	ejectedUntil  time.Time //zero when node is not ejected
+	recoveredAt   time.Time
+	probing       bool      //a probe request is in flight after ejection expired
+	probeDeadline time.Time //probe not reported before it is counted as failed
+}
+
+//ejected returns whether the node is unavailable at now
+func (nh *nodeHealth) ejected(now time.Time) bool {
+	if nh.ejectedUntil.IsZero() {
+		return false
+	}
+	return now.Before(nh.ejectedUntil) || (nh.probing && now.Before(nh.probeDeadline))
+}
+
+type outlierDetector struct {
+	policy  *OutlierPolicy
+	mutex   *sync.Mutex
+	healths map[string]*nodeHealth
+}
+
+func newOutlierDetector(policy *OutlierPolicy) *outlierDetector {
+	return &outlierDetector{policy: policy, mutex: &sync.Mutex{}, healths: make(map[string]*nodeHealth, 0)}
+}
+
+//keep health of nodes still alive
+func (od *outlierDetector) update(nodeList []*Node) {
+	od.mutex.Lock()
+	healths := make(map[string]*nodeHealth, len(nodeList))
+	for _, node := range nodeList {
+		addr := node.GetAddr()
+		if od.healths[addr] != nil {
+			healths[addr] = od.healths[addr]
+		} else {
+			healths[addr] = &nodeHealth{windowStart: time.Now()}
+		}
+	}
+	od.healths = healths
+	od.mutex.Unlock()
+}
+
+//nodes not ejected,all nodes are returned if every node is ejected
+func (od *outlierDetector) filter(nodeList []*Node) []*Node {
+	now := time.Now()
+	od.mutex.Lock()
+	defer od.mutex.Unlock()
+
+	available := make([]*Node, 0, len(nodeList))
+	for _, node := range nodeList {
+		health := od.healths[node.GetAddr()]
+		if health != nil && health.probing && !now.Before(health.probeDeadline) {
+			//probe never reported,count it as failed
+			health.probing = false
+			od.eject(node, health, now)
+		}
+		if health == nil || !health.ejected(now) {
+			available = append(available, node)
+		}
+	}
+	if len(available) == 0 {
+		return nodeList
+	}
+	return available
+}
+
+//a request sent to a node after its ejection expired serves as the only probe until it reports
+//or timeout passes
+func (od *outlierDetector) onPicked(node *Node, timeout time.Duration) {
+	now := time.Now()
+	od.mutex.Lock()
+	health := od.healths[node.GetAddr()]
+	if health != nil && !health.ejectedUntil.IsZero() && !health.ejected(now) {
+		health.probing = true
+		health.probeDeadline = now.Add(timeout)
+	}
+	od.mutex.Unlock()
+}
+
+//end the probe of node without result,the node can be probed again
+func (od *outlierDetector) release(node *Node) {
+	od.mutex.Lock()
+	health := od.healths[node.GetAddr()]
+	if health != nil {
+		health.probing = false
+	}
+	od.mutex.Unlock()
+}
+
+func (od *outlierDetector) report(node *Node, err error) {
+
+	now := time.Now()
+	failed := isNodeFailure(err)
+
+	od.mutex.Lock()
+	defer od.mutex.Unlock()
+
+	health := od.healths[node.GetAddr()]
+	if health == nil {
+		return
+	}
+
+	if health.probing {
+		health.probing = false
+		if failed {
+			od.eject(node, health, now)
+		} else {
+			health.ejectedUntil = time.Time{}
+			health.consecutive = 0
+			health.total = 0
+			health.errors = 0
+			health.windowStart = now
+			health.recoveredAt = now
+			elog.Infof("node %s recovered", node.GetAddr())
+		}
+		return
+	}
+	if health.ejected(now) {
+		return
+	}
+
+	//forget ejections in a row once the node keeps healthy long enough
+	if health.ejectCount > 0 && health.ejectedUntil.IsZero() && now.Sub(health.recoveredAt) > od.policy.MaxEjectionTime {
+		health.ejectCount = 0
+	}
+	if now.Sub(health.windowStart) > od.policy.Interval {
+		health.total = 0
+		health.errors = 0
+		health.windowStart = now
+	}
+
+	health.total++
+	if !failed {
+		health.consecutive = 0
+		return
+	}
+	health.errors++
+	health.consecutive++
+
+	if od.policy.ConsecutiveErrors > 0 && health.consecutive >= od.policy.ConsecutiveErrors {
+		od.eject(node, health, now)
+		return
+	}
+	if od.policy.ErrorRate > 0 && health.total >= od.policy.MinRequests &&
+		float64(health.errors)/float64(health.total) > od.policy.ErrorRate {
+		od.eject(node, health, now)
+	}
+}
+
+//must be called with mutex held
+func (od *outlierDetector) eject(node *Node, health *nodeHealth, now time.Time) {
+
+	ejected := 0
+	for _, h := range od.healths {
+		if h != health && h.ejected(now) {
+			ejected++
+		}
+	}
+	if (ejected+1)*100 > od.policy.MaxEjectionPercent*len(od.healths) {
+		health.consecutive = 0
+		return
+	}
+
+	ejectionTime := od.policy.BaseEjectionTime << uint(health.ejectCount)
+	if ejectionTime > od.policy.MaxEjectionTime || ejectionTime <= 0 {
+		ejectionTime = od.policy.MaxEjectionTime
+	}
+	health.ejectCount++
+	health.ejectedUntil = now.Add(ejectionTime)
+	health.consecutive = 0
+	health.total = 0
+	health.errors = 0
+	health.windowStart = now
+	elog.Errorf("node %s ejected for %v", node.GetAddr(), ejectionTime)
+}
+
+//system errors and timeouts are counted as node failures,logic errors,rate limited calls and calls
+//rejected by open breakers are not
+func isNodeFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	sysErr, ok := err.(*SystemError)
+	if !ok {
+		return false
+	}
+	ret := sysErr.GetRet()
+	return ret != ERROR_METHOD_NOT_FOUND && ret != ERROR_RATE_LIMITED && ret != ERROR_CIRCUIT_OPEN
+}
@@ -0,0 +1,126 @@
+package easycall
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOutlierEjectAndProbe(t *testing.T) {
+
+	policy := NewOutlierPolicy()
+	policy.ConsecutiveErrors = 3
+	policy.BaseEjectionTime = time.Millisecond * 50
+	detector := newOutlierDetector(policy)
+
+	nodeList := newTestNodes(4, 100)
+	detector.update(nodeList)
+	bad := nodeList[0]
+	timeout := NewSystemError(ERROR_TIME_OUT, "request time out")
+
+	for i := 0; i < 3; i++ {
+		detector.report(bad, timeout)
+	}
+	if len(detector.filter(nodeList)) != 3 {
+		t.Fatal("bad node not ejected")
+	}
+
+	time.Sleep(time.Millisecond * 60)
+	if len(detector.filter(nodeList)) != 4 {
+		t.Fatal("bad node not probed after ejection")
+	}
+	detector.onPicked(bad, time.Second)
+	if len(detector.filter(nodeList)) != 3 {
+		t.Fatal("bad node picked twice while probing")
+	}
+
+	//probe failed,ejection time doubles
+	detector.report(bad, timeout)
+	time.Sleep(time.Millisecond * 60)
+	if len(detector.filter(nodeList)) != 3 {
+		t.Fatal("ejection time not doubled")
+	}
+	time.Sleep(time.Millisecond * 50)
+	detector.onPicked(bad, time.Second)
+	detector.report(bad, nil)
+	if len(detector.filter(nodeList)) != 4 {
+		t.Fatal("bad node not recovered")
+	}
+}
+
+func TestOutlierProbeDeadline(t *testing.T) {
+
+	policy := NewOutlierPolicy()
+	policy.ConsecutiveErrors = 1
+	policy.BaseEjectionTime = time.Millisecond * 20
+	detector := newOutlierDetector(policy)
+
+	nodeList := newTestNodes(4, 100)
+	detector.update(nodeList)
+	bad := nodeList[0]
+	detector.report(bad, NewSystemError(ERROR_TIME_OUT, "request time out"))
+
+	//the probe never reports,it fails after its timeout and the node is ejected again
+	time.Sleep(time.Millisecond * 30)
+	detector.onPicked(bad, time.Millisecond*20)
+	time.Sleep(time.Millisecond * 30)
+	if len(detector.filter(nodeList)) != 3 {
+		t.Fatal("bad node not ejected again after probe timeout")
+	}
+	time.Sleep(time.Millisecond * 50)
+	if len(detector.filter(nodeList)) != 4 {
+		t.Fatal("bad node ejected for good after lost probe")
+	}
+}
+
+func TestOutlierLogicError(t *testing.T) {
+
+	policy := NewOutlierPolicy()
+	policy.ConsecutiveErrors = 3
+	detector := newOutlierDetector(policy)
+
+	nodeList := newTestNodes(2, 100)
+	detector.update(nodeList)
+	for i := 0; i < 10; i++ {
+		detector.report(nodeList[0], NewLogicError(3001, "user not found"))
+	}
+	if len(detector.filter(nodeList)) != 2 {
+		t.Fatal("node ejected by logic errors")
+	}
+}
+
+func TestOutlierMaxEjectionPercent(t *testing.T) {
+
+	policy := NewOutlierPolicy()
+	policy.ConsecutiveErrors = 1
+	detector := newOutlierDetector(policy)
+
+	nodeList := newTestNodes(4, 100)
+	detector.update(nodeList)
+	for _, node := range nodeList {
+		detector.report(node, NewSystemError(ERROR_INTERNAL_ERROR, "internal error"))
+	}
+	if len(detector.filter(nodeList)) != 2 {
+		t.Fatal("more than half of nodes ejected")
+	}
+}
+
+func TestOutlierEncodeFailure(t *testing.T) {
+
+	nodeList := startTestServices(t, 0)
+	policy := NewOutlierPolicy()
+	policy.ConsecutiveErrors = 1
+	policy.MaxEjectionPercent = 100
+	client := NewStaticServiceClient("profile", nodeList, 10, LB_RANDOM, WithOutlierDetection(policy))
+
+	err := client.Request("GetProfile", map[string]interface{}{"ch": make(chan int)}, nil, time.Second)
+	if sysErr, ok := err.(*SystemError); !ok || sysErr.GetRet() != ERROR_INTERNAL_ERROR {
+		t.Fatalf("expect internal error,got %v", err)
+	}
+	client.outlier.mutex.Lock()
+	health := client.outlier.healths[nodeList[0].GetAddr()]
+	ejected := health.ejected(time.Now())
+	client.outlier.mutex.Unlock()
+	if ejected {
+		t.Fatal("encode failure charged to node")
+	}
+}
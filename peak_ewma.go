@@ -0,0 +1,53 @@
+package easycall
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	EWMA_DECAY_TIME = 10 * time.Second //time constant of latency ewma decay
+	EWMA_PENALTY    = float64(time.Second)
+)
+
+//peak ewma of a node's response latency,a slower sample replaces the average at once
+//and faster samples pull it down gradually
+type nodeLatency struct {
+	mutex    *sync.Mutex
+	ewma     float64
+	lastTime time.Time
+}
+
+func newNodeLatency() *nodeLatency {
+	return &nodeLatency{mutex: &sync.Mutex{}}
+}
+
+func (nl *nodeLatency) observe(spend time.Duration) {
+	now := time.Now()
+	rtt := float64(spend)
+
+	nl.mutex.Lock()
+	if rtt > nl.ewma {
+		nl.ewma = rtt
+	} else {
+		elapsed := float64(now.Sub(nl.lastTime))
+		w := math.Exp(-elapsed / float64(EWMA_DECAY_TIME))
+		nl.ewma = nl.ewma*w + rtt*(1-w)
+	}
+	nl.lastTime = now
+	nl.mutex.Unlock()
+}
+
+//expected cost of sending one more request to the node with active requests in flight
+func (nl *nodeLatency) cost(active int32) float64 {
+	nl.mutex.Lock()
+	ewma := nl.ewma
+	nl.mutex.Unlock()
+
+	if ewma == 0 && active > 0 {
+		//never answered yet but busy
+		return EWMA_PENALTY + float64(active)
+	}
+	return ewma * float64(active+1)
+}
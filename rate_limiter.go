@@ -0,0 +1,238 @@
+package easycall
+
+import (
+	"container/list"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/starjiang/elog"
+)
+
+const (
+	RL_KEY_METHOD      = ""       //one bucket for the method
+	RL_KEY_UID         = "uid"    //one bucket for every head Uid
+	RL_KEY_IP          = "ip"     //one bucket for every head RequestIp
+	RL_KEY_CALLER      = "caller" //one bucket for every caller service in head meta META_CALLER,set by WithCaller
+	RL_KEY_META        = "meta."  //prefix of head meta key,e.g. "meta.appId" for one bucket for every appId
+	RL_ALL_METHODS     = "*"      //limit of methods without their own limit
+	RL_MAX_BUCKETS     = 10000    //least recently used buckets are dropped beyond it
+	RL_RELOAD_INTERVAL = 10 * time.Second
+	META_CALLER        = "caller" //head meta of caller service name
+)
+
+//RateLimit of a method,calls beyond Rate per second are rejected with ERROR_RATE_LIMITED
+//after Burst tokens are used up
+type RateLimit struct {
+	Rate  float64 //tokens added per second
+	Burst int     //max tokens,it is at least 1
+	Key   string  //RL_KEY_*,bucket key of calls
+}
+
+//RateLimitConfig loaded by EasyConfig.GetConfig,methods are map keys,e.g. with prefix "ratelimit."
+//ratelimit.rate=GetProfile:100,*:1000
+//ratelimit.burst=GetProfile:200
+//ratelimit.key=GetProfile:uid
+type RateLimitConfig struct {
+	Rate  map[string]float64
+	Burst map[string]int64
+	Key   map[string]string
+}
+
+type tokenBucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+//take a token after refilling tokens since last take
+func (tb *tokenBucket) take(limit *RateLimit, now time.Time) bool {
+	tb.refill(limit, now)
+	if tb.tokens < 1 {
+		return false
+	}
+	tb.tokens--
+	return true
+}
+
+func (tb *tokenBucket) refill(limit *RateLimit, now time.Time) {
+	tb.tokens += now.Sub(tb.last).Seconds() * limit.Rate
+	if tb.tokens > float64(limit.Burst) {
+		tb.tokens = float64(limit.Burst)
+	}
+	tb.last = now
+}
+
+//RateLimiter is a token bucket middleware for ServiceContext.AddMiddleware,
+//methods without limit are not limited,at most RL_MAX_BUCKETS buckets are kept in lru order
+type RateLimiter struct {
+	mutex   *sync.Mutex
+	limits  map[string]*RateLimit
+	buckets map[string]*list.Element
+	lru     *list.List
+}
+
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{mutex: &sync.Mutex{}, limits: make(map[string]*RateLimit, 0), buckets: make(map[string]*list.Element, 0), lru: list.New()}
+}
+
+//limiter loaded from config and reloaded every RL_RELOAD_INTERVAL,remote config changes take effect after
+//EasyConfig reloads them
+//prefix config name prefix,see RateLimitConfig
+func NewRateLimiterFromConfig(config *EasyConfig, prefix string) *RateLimiter {
+	rl := NewRateLimiter()
+	rl.LoadConfig(config, prefix)
+	go func() {
+		for range time.NewTicker(RL_RELOAD_INTERVAL).C {
+			rl.LoadConfig(config, prefix)
+		}
+	}()
+	return rl
+}
+
+//method service method,RL_ALL_METHODS for methods without their own limit
+//rate tokens added per second,0 or less removes the limit
+//burst max tokens
+//key RL_KEY_*
+func (rl *RateLimiter) SetLimit(method string, rate float64, burst int, key string) *RateLimiter {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	rl.removeBuckets(method)
+	if rate <= 0 {
+		delete(rl.limits, method)
+		return rl
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	rl.limits[method] = &RateLimit{Rate: rate, Burst: burst, Key: key}
+	return rl
+}
+
+func (rl *RateLimiter) GetLimit(method string) *RateLimit {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	limit := rl.limits[method]
+	if limit == nil {
+		return nil
+	}
+	copyLimit := *limit
+	return &copyLimit
+}
+
+//replace limits with the ones in config,buckets of unchanged limits are kept
+func (rl *RateLimiter) LoadConfig(config *EasyConfig, prefix string) {
+
+	rlConfig := &RateLimitConfig{}
+	config.GetConfig(prefix, rlConfig)
+
+	limits := make(map[string]*RateLimit, len(rlConfig.Rate))
+	for method, rate := range rlConfig.Rate {
+		if rate <= 0 {
+			continue
+		}
+		burst := int(rlConfig.Burst[method])
+		if burst < 1 {
+			burst = 1
+		}
+		limits[method] = &RateLimit{Rate: rate, Burst: burst, Key: rlConfig.Key[method]}
+	}
+
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	for method, limit := range rl.limits {
+		if newLimit := limits[method]; newLimit == nil || *newLimit != *limit {
+			rl.removeBuckets(method)
+		} else {
+			limits[method] = limit
+		}
+	}
+	for method, limit := range limits {
+		if rl.limits[method] != limit {
+			elog.Infof("rate limit of %s: rate=%v,burst=%d,key=%s", method, limit.Rate, limit.Burst, limit.Key)
+		}
+	}
+	rl.limits = limits
+}
+
+//bucket key of a call,calls with empty key value share one bucket
+func (rl *RateLimiter) bucketKey(method string, limit *RateLimit, head *EasyHead) string {
+	switch {
+	case limit.Key == RL_KEY_UID:
+		return method + "|" + strconv.FormatUint(head.GetUid(), 10)
+	case limit.Key == RL_KEY_IP:
+		return method + "|" + head.GetRequestIp()
+	case limit.Key == RL_KEY_CALLER:
+		return method + "|" + head.GetMeta(META_CALLER)
+	case strings.HasPrefix(limit.Key, RL_KEY_META):
+		return method + "|" + head.GetMeta(limit.Key[len(RL_KEY_META):])
+	}
+	return method + "|"
+}
+
+//whether a call of head is allowed
+func (rl *RateLimiter) Allow(head *EasyHead) bool {
+
+	now := time.Now()
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	method := head.GetMethod()
+	limit := rl.limits[method]
+	if limit == nil {
+		method = RL_ALL_METHODS
+		limit = rl.limits[method]
+	}
+	if limit == nil {
+		return true
+	}
+
+	key := rl.bucketKey(method, limit, head)
+	elem := rl.buckets[key]
+	if elem == nil {
+		//a dropped bucket starts full again when its key comes back
+		if rl.lru.Len() >= RL_MAX_BUCKETS {
+			oldest := rl.lru.Back()
+			rl.lru.Remove(oldest)
+			delete(rl.buckets, oldest.Value.(*tokenBucket).key)
+		}
+		elem = rl.lru.PushFront(&tokenBucket{key: key, tokens: float64(limit.Burst), last: now})
+		rl.buckets[key] = elem
+	} else {
+		rl.lru.MoveToFront(elem)
+	}
+	return elem.Value.(*tokenBucket).take(limit, now)
+}
+
+//must be called with mutex held
+func (rl *RateLimiter) removeBuckets(method string) {
+	prefix := method + "|"
+	for key, elem := range rl.buckets {
+		if strings.HasPrefix(key, prefix) {
+			rl.lru.Remove(elem)
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+func (rl *RateLimiter) Middleware(req *Request, resp *Response, client *EasyConnection, next *MiddlewareInfo) {
+
+	head := req.GetHead()
+	if rl.Allow(head) {
+		next.Middleware(req, resp, client, next.Next)
+		return
+	}
+
+	head.SetRet(ERROR_RATE_LIMITED)
+	head.SetMsg("method " + head.GetMethod() + " is rate limited")
+	resp.SetHead(head)
+	respPkg := NewPackageWithBody(req.GetFormat(), head, make(map[string]interface{}))
+	pkgData, err := respPkg.EncodeWithBody()
+	if err != nil {
+		elog.Error("encode pkg fail:", err)
+		return
+	}
+	client.Send(pkgData)
+}
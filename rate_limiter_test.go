@@ -0,0 +1,112 @@
+package easycall
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterKey(t *testing.T) {
+
+	rl := NewRateLimiter().SetLimit("GetProfile", 1, 2, RL_KEY_UID)
+	head := NewEasyHead().SetMethod("GetProfile").SetUid(1)
+	for i := 0; i < 2; i++ {
+		if !rl.Allow(head) {
+			t.Fatalf("call %d rejected within burst", i)
+		}
+	}
+	if rl.Allow(head) {
+		t.Fatal("call beyond burst allowed")
+	}
+	if !rl.Allow(NewEasyHead().SetMethod("GetProfile").SetUid(2)) {
+		t.Fatal("call of other uid rejected")
+	}
+	if !rl.Allow(NewEasyHead().SetMethod("SetProfile").SetUid(1)) {
+		t.Fatal("call of method without limit rejected")
+	}
+
+	rl.SetLimit(RL_ALL_METHODS, 1, 1, RL_KEY_META+"appId")
+	head = NewEasyHead().SetMethod("SetProfile").SetMeta("appId", "app1")
+	if !rl.Allow(head) || rl.Allow(head) {
+		t.Fatal("default limit not applied by meta key")
+	}
+}
+
+func TestRateLimiterConfig(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "easycall")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config")
+	err = ioutil.WriteFile(path, []byte("ratelimit.rate=GetProfile:10\nratelimit.burst=GetProfile:5\nratelimit.key=GetProfile:caller\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := NewLocalEasyConfig(path)
+	rl := NewRateLimiter()
+	rl.LoadConfig(config, "ratelimit.")
+	limit := rl.GetLimit("GetProfile")
+	if limit == nil || limit.Rate != 10 || limit.Burst != 5 || limit.Key != RL_KEY_CALLER {
+		t.Fatalf("unexpected limit:%v", limit)
+	}
+
+	err = ioutil.WriteFile(path, []byte("ratelimit.rate=SetProfile:1\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config = NewLocalEasyConfig(path)
+	rl.LoadConfig(config, "ratelimit.")
+	if rl.GetLimit("GetProfile") != nil || rl.GetLimit("SetProfile") == nil {
+		t.Fatal("limits not reloaded")
+	}
+}
+
+func TestRateLimiterMiddleware(t *testing.T) {
+
+	rl := NewRateLimiter().SetLimit("GetProfile", 0.1, 1, RL_KEY_CALLER)
+	port := newClosedPorts(t, 1)[0]
+	server := &Server{}
+	err := server.CreateServer(port, NewServiceHandler(&testService{0, port}, []*MiddlewareInfo{{rl.Middleware, nil}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodeList := []*Node{{Ip: "127.0.0.1", Port: port, Weight: 100}}
+	client := NewStaticServiceClient("profile", nodeList, 10, LB_RANDOM, WithCaller("order"))
+	other := NewStaticServiceClient("profile", nodeList, 10, LB_RANDOM, WithCaller("user"))
+
+	resp := make(map[string]interface{})
+	err = client.Request("GetProfile", map[string]interface{}{}, &resp, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.Request("GetProfile", map[string]interface{}{}, &resp, time.Second)
+	if sysErr, ok := err.(*SystemError); !ok || sysErr.GetRet() != ERROR_RATE_LIMITED {
+		t.Fatalf("expect rate limited error,got %v", err)
+	}
+	err = other.Request("GetProfile", map[string]interface{}{}, &resp, time.Second)
+	if err != nil {
+		t.Fatalf("other caller limited,err=%v", err)
+	}
+}
+
+func TestRateLimiterMaxBuckets(t *testing.T) {
+
+	rl := NewRateLimiter().SetLimit("GetProfile", 1, 1, RL_KEY_UID)
+	head := NewEasyHead().SetMethod("GetProfile").SetUid(1)
+	rl.Allow(head)
+	for uid := 2; uid <= RL_MAX_BUCKETS+100; uid++ {
+		rl.Allow(NewEasyHead().SetMethod("GetProfile").SetUid(uint64(uid)))
+	}
+	if len(rl.buckets) != RL_MAX_BUCKETS || rl.lru.Len() != RL_MAX_BUCKETS {
+		t.Fatalf("buckets exceed max,%d", len(rl.buckets))
+	}
+	if rl.buckets["GetProfile|1"] != nil {
+		t.Fatal("least recently used bucket kept")
+	}
+}
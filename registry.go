@@ -0,0 +1,57 @@
+package easycall
+
+//WatchFunc receives the whole node list of a service each time it changes
+type WatchFunc func(nodeList []*Node)
+
+//Registry for service registration and discovery
+type Registry interface {
+	//register node as a provider of service name
+	Register(name string, node *Node) error
+	//remove node from the providers of service name
+	Deregister(name string, node *Node) error
+	//list current providers of service name
+	List(name string) ([]*Node, error)
+	//call watcher with the new node list when providers of service name change
+	Watch(name string, watcher WatchFunc) error
+}
+
+func copyNode(node *Node) *Node {
+	n := *node
+	if node.Meta != nil {
+		n.Meta = make(map[string]string, len(node.Meta))
+		for k, v := range node.Meta {
+			n.Meta[k] = v
+		}
+	}
+	return &n
+}
+
+func copyNodes(nodeList []*Node) []*Node {
+	list := make([]*Node, 0, len(nodeList))
+	for _, node := range nodeList {
+		list = append(list, copyNode(node))
+	}
+	return list
+}
+
+//replace the node with the same address or append it
+func upsertNode(nodeList []*Node, node *Node) []*Node {
+	for i, n := range nodeList {
+		if n.GetAddr() == node.GetAddr() {
+			list := append([]*Node{}, nodeList...)
+			list[i] = copyNode(node)
+			return list
+		}
+	}
+	return append(append([]*Node{}, nodeList...), copyNode(node))
+}
+
+func removeNode(nodeList []*Node, node *Node) []*Node {
+	list := make([]*Node, 0, len(nodeList))
+	for _, n := range nodeList {
+		if n.GetAddr() != node.GetAddr() {
+			list = append(list, n)
+		}
+	}
+	return list
+}
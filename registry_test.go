@@ -0,0 +1,146 @@
+package easycall
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStaticRegistry(t *testing.T) {
+
+	registry := NewStaticRegistry(map[string][]*Node{
+		"profile": {{Ip: "127.0.0.1", Port: 8001, Weight: 100}},
+	})
+
+	var watched []*Node
+	registry.Watch("profile", func(nodeList []*Node) {
+		watched = nodeList
+	})
+
+	registry.Register("profile", &Node{Ip: "127.0.0.1", Port: 8002, Weight: 50})
+	nodeList, err := registry.List("profile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodeList) != 2 || len(watched) != 2 {
+		t.Fatalf("expect 2 nodes,got %d,watched %d", len(nodeList), len(watched))
+	}
+
+	registry.Deregister("profile", &Node{Ip: "127.0.0.1", Port: 8001})
+	nodeList, _ = registry.List("profile")
+	if len(nodeList) != 1 || nodeList[0].Port != 8002 || len(watched) != 1 {
+		t.Fatalf("unexpected nodes after deregister:%v", nodeList)
+	}
+}
+
+func TestFileRegistry(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "easycall")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "registry.json")
+	err = ioutil.WriteFile(path, []byte(`{"profile":[{"ip":"127.0.0.1","port":8001,"weight":100}]}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registry, err := NewFileRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer registry.Close()
+
+	nodeList, _ := registry.List("profile")
+	if len(nodeList) != 1 || nodeList[0].Weight != 100 {
+		t.Fatalf("unexpected nodes:%v", nodeList)
+	}
+
+	err = registry.Register("profile", &Node{Ip: "127.0.0.1", Port: 8002, Weight: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := NewFileRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	nodeList, _ = other.List("profile")
+	if len(nodeList) != 2 {
+		t.Fatalf("expect 2 nodes in file,got %d", len(nodeList))
+	}
+
+	//file changed by others is reloaded and watchers are notified
+	var watched []*Node
+	other.Watch("profile", func(nodeList []*Node) {
+		watched = nodeList
+	})
+	err = ioutil.WriteFile(path, []byte(`{"profile":[{"ip":"127.0.0.1","port":8003,"weight":100}]}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Now().Add(time.Second)
+	os.Chtimes(path, modTime, modTime)
+	other.check()
+	if len(watched) != 1 || watched[0].Port != 8003 {
+		t.Fatalf("watcher not notified of file change,watched %v", watched)
+	}
+
+	os.Remove(path)
+	other.check()
+	nodeList, _ = other.List("profile")
+	if len(watched) != 0 || len(nodeList) != 0 {
+		t.Fatalf("nodes kept after file deleted,watched %d,listed %d", len(watched), len(nodeList))
+	}
+
+	other.Close()
+	select {
+	case <-other.stop:
+	default:
+		t.Fatal("registry not closed")
+	}
+}
+
+func TestNodeMeta(t *testing.T) {
+
+	info := &ServiceInfo{name: "profile", port: 8001, weight: 100, meta: make(map[string]string)}
+	for _, opt := range []ServiceOption{WithServiceVersion("v2"), WithServiceZone("az1"), WithServiceTags("canary", "gray")} {
+		opt(info)
+	}
+
+	registry := NewStaticRegistry(nil)
+	registry.Register("profile", &Node{Ip: "127.0.0.1", Port: info.port, Weight: info.weight, Meta: info.meta})
+	nodeList, _ := registry.List("profile")
+	node := nodeList[0]
+
+	if node.GetVersion() != "v2" || node.GetZone() != "az1" {
+		t.Fatalf("unexpected meta:%v", node.Meta)
+	}
+	if !node.HasTag("canary") || !node.HasTag("gray") || node.HasTag("stable") {
+		t.Fatalf("unexpected tags:%v", node.GetTags())
+	}
+}
+
+func TestStaticServiceClient(t *testing.T) {
+
+	nodeList := startTestServices(t, 0, 0)
+	client := NewStaticServiceClient("profile", nodeList, 10, LB_RANDOM_WEIGHT)
+
+	ports := make(map[int]bool)
+	for i := 0; i < 20; i++ {
+		resp := make(map[string]interface{})
+		err := client.Request("GetProfile", map[string]interface{}{}, &resp, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ports[respPort(resp)] = true
+	}
+	if len(ports) != 2 {
+		t.Fatalf("expect requests to both nodes,got %v", ports)
+	}
+}
@@ -0,0 +1,83 @@
+package easycall
+
+import (
+	"math/rand"
+	"time"
+)
+
+const (
+	RETRY_BASE_BACKOFF = 10 * time.Millisecond
+	RETRY_MAX_BACKOFF  = 1000 * time.Millisecond
+)
+
+//RetryPolicy retries failed requests on other nodes,timeout requests are retried only for idempotent methods
+type RetryPolicy struct {
+	MaxAttempts int           //max attempts including the first one
+	RetryCodes  []int         //system error codes to retry
+	BaseBackoff time.Duration //backoff before the first retry,it doubles on every retry with full jitter
+	MaxBackoff  time.Duration //max backoff
+	idempotent  map[string]bool
+}
+
+//maxAttempts max attempts including the first one
+func NewRetryPolicy(maxAttempts int) *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: maxAttempts,
+		RetryCodes:  []int{ERROR_TIME_OUT, ERROR_SERVICE_BUSY, ERROR_CONNECTION_LOST, ERROR_CIRCUIT_OPEN},
+		BaseBackoff: RETRY_BASE_BACKOFF,
+		MaxBackoff:  RETRY_MAX_BACKOFF,
+		idempotent:  make(map[string]bool, 0),
+	}
+}
+
+func (rp *RetryPolicy) SetRetryCodes(codes ...int) *RetryPolicy {
+	rp.RetryCodes = codes
+	return rp
+}
+
+func (rp *RetryPolicy) SetBackoff(base time.Duration, max time.Duration) *RetryPolicy {
+	rp.BaseBackoff = base
+	rp.MaxBackoff = max
+	return rp
+}
+
+//methods safe to be called more than once,only they are retried after timeout
+func (rp *RetryPolicy) SetIdempotent(methods ...string) *RetryPolicy {
+	for _, method := range methods {
+		rp.idempotent[method] = true
+	}
+	return rp
+}
+
+func (rp *RetryPolicy) IsIdempotent(method string) bool {
+	return rp.idempotent[method]
+}
+
+//whether a request of method failed with err can be retried
+func (rp *RetryPolicy) retryable(method string, err error) bool {
+	sysErr, ok := err.(*SystemError)
+	if !ok {
+		return false
+	}
+	if sysErr.GetRet() == ERROR_TIME_OUT && !rp.IsIdempotent(method) {
+		return false
+	}
+	for _, code := range rp.RetryCodes {
+		if code == sysErr.GetRet() {
+			return true
+		}
+	}
+	return false
+}
+
+//backoff before the retry after attempts
+func (rp *RetryPolicy) backoff(attempts int) time.Duration {
+	backoff := rp.BaseBackoff << uint(attempts-1)
+	if backoff > rp.MaxBackoff || backoff <= 0 {
+		backoff = rp.MaxBackoff
+	}
+	if backoff <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(backoff) + 1))
+}
@@ -0,0 +1,66 @@
+package easycall
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy(t *testing.T) {
+
+	policy := NewRetryPolicy(3).SetIdempotent("GetProfile")
+
+	timeout := NewSystemError(ERROR_TIME_OUT, "request time out")
+	if !policy.retryable("GetProfile", timeout) || policy.retryable("SetProfile", timeout) {
+		t.Fatal("timeout should be retried only for idempotent methods")
+	}
+	if !policy.retryable("SetProfile", NewSystemError(ERROR_SERVICE_BUSY, "busy")) {
+		t.Fatal("busy should be retried")
+	}
+	if policy.retryable("GetProfile", NewLogicError(3001, "user not found")) {
+		t.Fatal("logic error should not be retried")
+	}
+
+	policy.SetBackoff(time.Millisecond*10, time.Millisecond*30)
+	for attempts := 1; attempts < 10; attempts++ {
+		if policy.backoff(attempts) > time.Millisecond*30 {
+			t.Fatal("backoff exceeds max backoff")
+		}
+	}
+}
+
+//free ports nobody listens on
+func newClosedPorts(t *testing.T, count int) []int {
+	ports := make([]int, 0, count)
+	for i := 0; i < count; i++ {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ports = append(ports, listener.Addr().(*net.TCPAddr).Port)
+		listener.Close()
+	}
+	return ports
+}
+
+func TestRetryOtherNodes(t *testing.T) {
+
+	nodeList := make([]*Node, 0)
+	for _, port := range newClosedPorts(t, 3) {
+		nodeList = append(nodeList, &Node{Ip: "127.0.0.1", Port: port, Weight: 100})
+	}
+	registry := NewStaticRegistry(map[string][]*Node{"profile": nodeList})
+
+	policy := NewRetryPolicy(5).SetBackoff(time.Millisecond, time.Millisecond)
+	client := NewServiceClientWithRegistry(registry, "profile", 10, LB_RANDOM, WithRetryPolicy(policy))
+
+	err := client.Request("GetProfile", map[string]interface{}{}, &map[string]interface{}{}, time.Second)
+	sysErr, ok := err.(*SystemError)
+	if !ok || sysErr.GetRet() != ERROR_CONNECTION_LOST {
+		t.Fatalf("unexpected error:%v", err)
+	}
+	//every node is tried once
+	if len(client.poolMap) != 3 {
+		t.Fatalf("expect 3 nodes tried,got %d", len(client.poolMap))
+	}
+}
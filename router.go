@@ -0,0 +1,214 @@
+package easycall
+
+import (
+	"context"
+	"encoding/json"
+	"hash/crc32"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/starjiang/elog"
+)
+
+//RouteRule routes matched requests to nodes chosen by Selector
+type RouteRule struct {
+	Methods   []string `json:"methods"`   //match any method when empty
+	Uids      []uint64 `json:"uids"`      //match any uid when empty
+	RouteKeys []string `json:"routeKeys"` //match any routeKey when empty
+	Selector  string   `json:"selector"`  //"version=v2" matches node metadata,"canary" matches a node tag
+	Percent   int      `json:"percent"`   //percent of matched requests sent to selected nodes,0 means 100
+}
+
+func (rule *RouteRule) match(head *EasyHead) bool {
+
+	if len(rule.Methods) > 0 && !containsString(rule.Methods, head.GetMethod()) {
+		return false
+	}
+	if len(rule.RouteKeys) > 0 && !containsString(rule.RouteKeys, head.GetRouteKey()) {
+		return false
+	}
+	if len(rule.Uids) > 0 {
+		for _, uid := range rule.Uids {
+			if uid == head.GetUid() {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+//requests of the same uid or routeKey always get the same result
+func (rule *RouteRule) hit(head *EasyHead) bool {
+
+	if rule.Percent <= 0 || rule.Percent >= 100 {
+		return true
+	}
+	var bucket int
+	if head.GetUid() != 0 {
+		bucket = int(head.GetUid() % 100)
+	} else if head.GetRouteKey() != "" {
+		bucket = int(crc32.ChecksumIEEE([]byte(head.GetRouteKey())) % 100)
+	} else {
+		bucket = rand.Intn(100)
+	}
+	return bucket < rule.Percent
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+//Router chooses candidate nodes by route rules of every service before load balance,
+//requests not routed by any rule go to nodes not selected by any rule
+type Router struct {
+	rwmutex *sync.RWMutex
+	rules   map[string][]*RouteRule
+	cli     *clientv3.Client //nil when rules are not loaded from etcd
+	cancel  context.CancelFunc
+}
+
+func NewRouter() *Router {
+	return &Router{rwmutex: &sync.RWMutex{}, rules: make(map[string][]*RouteRule, 0)}
+}
+
+//load rules from etcd and reload them when they change,
+//rules of a service are a json array stored at EASYCALL_ETCD_ROUTE_PATH/service
+func NewEtcdRouter(endpoints []string) (*Router, error) {
+
+	cli, err := clientv3.New(clientv3.Config{
+		Endpoints:   endpoints,
+		DialTimeout: ETCD_CONNECT_TIMEOUT * time.Second,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	router := NewRouter()
+	err = router.loadEtcd(cli)
+	if err != nil {
+		cli.Close()
+		return nil, err
+	}
+	router.cli = cli
+	ctx, cancel := context.WithCancel(context.Background())
+	router.cancel = cancel
+
+	go func() {
+		for {
+			rch := cli.Watch(ctx, EASYCALL_ETCD_ROUTE_PATH, clientv3.WithPrefix())
+			for range rch {
+				elog.Info(EASYCALL_ETCD_ROUTE_PATH, "route rules reload")
+				err := router.loadEtcd(cli)
+				if err != nil {
+					elog.Error("reload route rules fail:", err)
+				}
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			elog.Error(EASYCALL_ETCD_ROUTE_PATH, "watch failed")
+			time.Sleep(time.Second)
+		}
+	}()
+	return router, nil
+}
+
+//stop reloading rules from etcd,rules loaded are kept
+func (r *Router) Close() error {
+	if r.cli == nil {
+		return nil
+	}
+	r.cancel()
+	return r.cli.Close()
+}
+
+func (r *Router) loadEtcd(cli *clientv3.Client) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), ETCD_CONNECT_TIMEOUT*time.Second)
+	resp, err := cli.Get(ctx, EASYCALL_ETCD_ROUTE_PATH, clientv3.WithPrefix())
+	cancel()
+	if err != nil {
+		return err
+	}
+
+	rules := make(map[string][]*RouteRule, 0)
+	for _, ev := range resp.Kvs {
+		service := strings.TrimPrefix(string(ev.Key), EASYCALL_ETCD_ROUTE_PATH+"/")
+		serviceRules := make([]*RouteRule, 0)
+		err = json.Unmarshal(ev.Value, &serviceRules)
+		if err != nil {
+			elog.Error("decode route rules of", service, "fail:", err)
+			continue
+		}
+		rules[service] = serviceRules
+	}
+
+	r.rwmutex.Lock()
+	r.rules = rules
+	r.rwmutex.Unlock()
+	return nil
+}
+
+//replace rules of service,rules are matched in order
+func (r *Router) SetRules(service string, rules []*RouteRule) {
+	r.rwmutex.Lock()
+	r.rules[service] = rules
+	r.rwmutex.Unlock()
+}
+
+func (r *Router) GetRules(service string) []*RouteRule {
+	r.rwmutex.RLock()
+	defer r.rwmutex.RUnlock()
+	return r.rules[service]
+}
+
+//choose candidates for request with head
+func (r *Router) Route(nodeList []*Node, head *EasyHead) []*Node {
+
+	rules := r.GetRules(head.GetService())
+	if len(rules) == 0 {
+		return nodeList
+	}
+
+	for _, rule := range rules {
+		if rule.match(head) && rule.hit(head) {
+			selected := make([]*Node, 0)
+			for _, node := range nodeList {
+				if node.Match(rule.Selector) {
+					selected = append(selected, node)
+				}
+			}
+			if len(selected) > 0 {
+				return selected
+			}
+			break
+		}
+	}
+
+	others := make([]*Node, 0, len(nodeList))
+	for _, node := range nodeList {
+		selected := false
+		for _, rule := range rules {
+			if node.Match(rule.Selector) {
+				selected = true
+				break
+			}
+		}
+		if !selected {
+			others = append(others, node)
+		}
+	}
+	if len(others) == 0 {
+		return nodeList
+	}
+	return others
+}
@@ -0,0 +1,62 @@
+package easycall
+
+import (
+	"testing"
+)
+
+func newVersionNodes() []*Node {
+	nodeList := newTestNodes(4, 100)
+	for i, node := range nodeList {
+		if i == 0 {
+			node.Meta = map[string]string{META_VERSION: "v2", META_TAGS: "canary"}
+		} else {
+			node.Meta = map[string]string{META_VERSION: "v1"}
+		}
+	}
+	return nodeList
+}
+
+func TestRouterUid(t *testing.T) {
+
+	router := NewRouter()
+	router.SetRules("profile", []*RouteRule{{Uids: []uint64{10001}, Selector: "version=v2"}})
+	nodeList := newVersionNodes()
+
+	candidates := router.Route(nodeList, NewEasyHead().SetService("profile").SetUid(10001))
+	if len(candidates) != 1 || candidates[0].GetVersion() != "v2" {
+		t.Fatalf("uid 10001 expect v2 node,got %v", candidates)
+	}
+
+	candidates = router.Route(nodeList, NewEasyHead().SetService("profile").SetUid(10002))
+	if len(candidates) != 3 {
+		t.Fatalf("uid 10002 expect 3 v1 nodes,got %d", len(candidates))
+	}
+	for _, node := range candidates {
+		if node.GetVersion() != "v1" {
+			t.Fatalf("uid 10002 routed to %s", node.GetVersion())
+		}
+	}
+}
+
+func TestRouterPercent(t *testing.T) {
+
+	router := NewRouter()
+	router.SetRules("profile", []*RouteRule{{Methods: []string{"GetProfile"}, Selector: "canary", Percent: 20}})
+	nodeList := newVersionNodes()
+
+	canary := 0
+	for uid := uint64(1); uid <= 1000; uid++ {
+		candidates := router.Route(nodeList, NewEasyHead().SetService("profile").SetMethod("GetProfile").SetUid(uid))
+		if len(candidates) == 1 && candidates[0].HasTag("canary") {
+			canary++
+		}
+	}
+	if canary != 200 {
+		t.Fatalf("expect 200 canary requests,got %d", canary)
+	}
+
+	candidates := router.Route(nodeList, NewEasyHead().SetService("profile").SetMethod("SetProfile").SetUid(1))
+	if len(candidates) != 3 {
+		t.Fatalf("unmatched method expect 3 nodes,got %d", len(candidates))
+	}
+}
@@ -1,6 +1,8 @@
 package easycall
 
 import (
+	"fmt"
+	"runtime/debug"
 	"strconv"
 	"sync"
 	"time"
@@ -16,15 +18,30 @@ const (
 )
 
 type ServiceClient struct {
-	sessionMgr      *EasySessionManager
-	nodeMgr         *NodeManager
-	poolMap         map[string]*GenericPool
-	mutex           *sync.Mutex
-	loadBalanceType int
-	poolSize        int
-	seq             uint64
-	serviceName     string
-	lb              *LoadBalancer
+	sessionMgr           *EasySessionManager
+	nodeMgr              *NodeManager
+	poolMap              map[string]*GenericPool
+	mutex                *sync.Mutex
+	loadBalanceType      int
+	poolSize             int
+	seq                  uint64
+	serviceName          string
+	balancerName         string
+	balancer             Balancer
+	hashBalancer         Balancer //for requests with routeKey
+	locality             *LocalityPolicy
+	router               *Router
+	slowStart            time.Duration
+	outlier              *outlierDetector
+	retry                *RetryPolicy
+	hedge                *hedger
+	interceptors         []InterceptorFunc
+	chain                *InterceptorInfo
+	broadcastConcurrency int
+	coalescer            *coalescer
+	breaker              *clientBreaker
+	bulkhead             *Bulkhead
+	caller               string //service name of the caller sent in head meta META_CALLER
 }
 
 //create a new service request client
@@ -32,21 +49,63 @@ type ServiceClient struct {
 //endpoints etcd endpoints list
 //serviceName microservice name
 //poolsize connection pool size
-//loadBalanceType for 5 kinds of loadbalance
-func NewServiceClient(endpoints []string, serviceName string, poolSize int, loadBalanceType int) *ServiceClient {
+//loadBalanceType for 7 kinds of loadbalance
+//opts client options
+func NewServiceClient(endpoints []string, serviceName string, poolSize int, loadBalanceType int, opts ...ClientOption) *ServiceClient {
 
-	ServiceClient := &ServiceClient{}
-	nodeMgr, err := NewNodeManager(endpoints, serviceName, ETCD_CONNECT_TIMEOUT*time.Second)
+	registry, err := NewEtcdRegistry(endpoints, ETCD_CONNECT_TIMEOUT*time.Second)
 	if err != nil {
-		elog.Error("new nodemgr fail:", err)
+		elog.Error("new registry fail:", err)
+		return NewServiceClientWithRegistry(nil, serviceName, poolSize, loadBalanceType, opts...)
 	}
-	ServiceClient.nodeMgr = nodeMgr
-	ServiceClient.sessionMgr = &EasySessionManager{sessionMap: make(map[uint64]*EasySession, 0), mutex: &sync.RWMutex{}}
+	return NewServiceClientWithRegistry(registry, serviceName, poolSize, loadBalanceType, opts...)
+}
+
+//create a new service request client calling fixed nodes without etcd
+
+//serviceName microservice name
+//nodeList fixed nodes with ip,port and weight
+//poolsize connection pool size
+//loadBalanceType for 7 kinds of loadbalance
+//opts client options
+func NewStaticServiceClient(serviceName string, nodeList []*Node, poolSize int, loadBalanceType int, opts ...ClientOption) *ServiceClient {
+	registry := NewStaticRegistry(map[string][]*Node{serviceName: nodeList})
+	return NewServiceClientWithRegistry(registry, serviceName, poolSize, loadBalanceType, opts...)
+}
+
+//create a new service request client with a custom registry
+
+//registry where service nodes are discovered
+//serviceName microservice name
+//poolsize connection pool size
+//loadBalanceType for 7 kinds of loadbalance
+//opts client options
+func NewServiceClientWithRegistry(registry Registry, serviceName string, poolSize int, loadBalanceType int, opts ...ClientOption) *ServiceClient {
+
+	ServiceClient := &ServiceClient{}
+	ServiceClient.sessionMgr = &EasySessionManager{sessionMap: make(map[uint64]*EasySession, 0), mutex: &sync.RWMutex{}, onDone: ServiceClient.onSessionDone}
 	ServiceClient.poolMap = make(map[string]*GenericPool, 0)
 	ServiceClient.mutex = &sync.Mutex{}
 	ServiceClient.loadBalanceType = loadBalanceType
+	ServiceClient.balancerName = GetBalancerName(loadBalanceType)
+	ServiceClient.poolSize = poolSize
 	ServiceClient.serviceName = serviceName
-	ServiceClient.lb = NewLoadBalancer()
+
+	for _, opt := range opts {
+		opt(ServiceClient)
+	}
+
+	balancer, err := NewBalancer(ServiceClient.balancerName)
+	if err != nil {
+		elog.Error("new balancer fail:", err)
+	}
+	ServiceClient.balancer = balancer
+	ServiceClient.hashBalancer, _ = NewBalancer(BALANCER_HASH)
+
+	if registry != nil {
+		ServiceClient.nodeMgr = NewNodeManagerWithRegistry(registry, serviceName)
+		ServiceClient.nodeMgr.addListener(ServiceClient.onNodesChanged)
+	}
 	return ServiceClient
 }
 
@@ -55,50 +114,41 @@ func NewServiceClient(endpoints []string, serviceName string, poolSize int, load
 //format serialize format type json/msgpack
 //head request head
 //body request body
-//timeout request timeout
+//timeout request timeout of every attempt
 func (ec *ServiceClient) RequestWithHead(format byte, head *EasyHead, body interface{}, timeout time.Duration) (*EasyPackage, error) {
 
-	ch, err := ec.RequestAsyncWithHead(format, head, body, timeout)
+	respPkg, err := ec.invoke(format, head, body, timeout)
 
-	if err != nil {
-		return nil, err
-	}
-	respPkg := <-ch
 	if respPkg == nil {
-		return nil, NewSystemError(ERROR_TIME_OUT, "request time out")
+		return nil, err
 	}
 	return respPkg, nil
 }
 
-func (ec *ServiceClient) Request(method string, reqBody interface{}, respBody interface{}, timeout time.Duration) error {
+//opts call options like WithRouteKey,WithFormat,WithTimeout
+func (ec *ServiceClient) Request(method string, reqBody interface{}, respBody interface{}, timeout time.Duration, opts ...CallOption) error {
 
-	ch, err := ec.RequestAsyncWithHead(FORMAT_MSGPACK, NewEasyHead().SetService(ec.serviceName).SetMethod(method), reqBody, timeout)
+	co := newCallOptions(ec.serviceName, method, timeout, opts)
+	respPkg, err := ec.invoke(co.format, co.head, reqBody, co.timeout)
 
 	if err != nil {
 		return err
 	}
-	respPkg := <-ch
-	if respPkg == nil {
-		return NewSystemError(ERROR_TIME_OUT, "request time out")
-	}
-
-	if respPkg.GetHead().GetRet() != 0 {
-		if respPkg.GetHead().GetRet() < ERROR_MAX_SYSTEM_CODE {
-			return NewSystemError(respPkg.GetHead().GetRet(), respPkg.GetHead().GetMsg())
-		} else {
-			return NewLogicError(respPkg.GetHead().GetRet(), respPkg.GetHead().GetMsg())
-		}
-	}
 
 	return respPkg.DecodeBody(respBody)
 
 }
 
-func (ec *ServiceClient) RequestAsync(method string, body interface{}, timeout time.Duration) (chan *EasyPackage, error) {
-	return ec.RequestAsyncWithHead(FORMAT_MSGPACK, NewEasyHead().SetService(ec.serviceName).SetMethod(method), body, timeout)
+//opts call options like WithRouteKey,WithFormat,WithTimeout
+func (ec *ServiceClient) RequestAsync(method string, body interface{}, timeout time.Duration, opts ...CallOption) (chan *EasyPackage, error) {
+	co := newCallOptions(ec.serviceName, method, timeout, opts)
+	return ec.RequestAsyncWithHead(co.format, co.head, body, co.timeout)
 }
 
-//request with head through by Async
+//request with head through by Async,interceptors and policies apply like RequestWithHead,
+//errors found before the request starts,like service not found,are returned at once,
+//later the channel receives nil when request times out,and a package with Ret and Msg set
+//when it fails before response,e.g. connection lost or rejected by breaker
 
 //format serialize format type json/msgpack
 //head request head
@@ -106,30 +156,311 @@ func (ec *ServiceClient) RequestAsync(method string, body interface{}, timeout t
 //timeout request timeout
 func (ec *ServiceClient) RequestAsyncWithHead(format byte, head *EasyHead, body interface{}, timeout time.Duration) (chan *EasyPackage, error) {
 
+	if _, err := ec.getNodes(head); err != nil {
+		return nil, err
+	}
+
+	respChan := make(chan *EasyPackage, 1)
+	go func() {
+		defer close(respChan)
+		defer PanicHandler()
+		respPkg, err := ec.invokeAsync(format, head, body, timeout)
+		if respPkg == nil {
+			respPkg = newErrorPackage(format, head, err)
+		}
+		respChan <- respPkg
+	}()
+	return respChan, nil
+}
+
+//package of a request failed before response,nil for timeout
+func newErrorPackage(format byte, head *EasyHead, err error) *EasyPackage {
+
+	errHead := *head
+	switch e := err.(type) {
+	case *SystemError:
+		if e.GetRet() == ERROR_TIME_OUT {
+			return nil
+		}
+		errHead.SetRet(e.GetRet()).SetMsg(e.GetMsg())
+	case *LogicError:
+		errHead.SetRet(e.GetRet()).SetMsg(e.GetMsg())
+	default:
+		errHead.SetRet(ERROR_INTERNAL_ERROR).SetMsg(err.Error())
+	}
+	//encode and decode so the body can be decoded like a response from network
+	pkgData, encodeErr := NewPackageWithBody(format, &errHead, make(map[string]interface{})).EncodeWithBody()
+	if encodeErr != nil {
+		return nil
+	}
+	respPkg, _ := DecodeWithBodyData(pkgData)
+	return respPkg
+}
+
+//interceptor for interceptor function chain of requests
+func (ec *ServiceClient) AddInterceptor(interceptor InterceptorFunc) {
+	ec.mutex.Lock()
+	ec.interceptors = append(ec.interceptors, interceptor)
+	chain := &InterceptorInfo{ec.finalInterceptor, nil}
+	for i := len(ec.interceptors) - 1; i >= 0; i-- {
+		chain = &InterceptorInfo{ec.interceptors[i], chain}
+	}
+	ec.chain = chain
+	ec.mutex.Unlock()
+}
+
+//run the request through interceptors
+func (ec *ServiceClient) invoke(format byte, head *EasyHead, body interface{}, timeout time.Duration) (*EasyPackage, error) {
+	inv := &Invocation{format: format, head: head, body: body, timeout: timeout}
+	err := ec.intercept(inv)
+	return inv.resp, err
+}
+
+//invoke in the goroutine of an asynchronous request,a panic is returned as ERROR_INTERNAL_ERROR
+//so the request still completes
+func (ec *ServiceClient) invokeAsync(format byte, head *EasyHead, body interface{}, timeout time.Duration) (respPkg *EasyPackage, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			elog.Error("Panic Exception:", r)
+			elog.Error(string(debug.Stack()))
+			respPkg, err = nil, NewSystemError(ERROR_INTERNAL_ERROR, fmt.Sprint("request panics:", r))
+		}
+	}()
+	return ec.invoke(format, head, body, timeout)
+}
+
+func (ec *ServiceClient) intercept(inv *Invocation) error {
+
+	if ec.caller != "" && inv.head.GetMeta(META_CALLER) == "" {
+		inv.head.SetMeta(META_CALLER, ec.caller)
+	}
+
+	ec.mutex.Lock()
+	chain := ec.chain
+	ec.mutex.Unlock()
+
+	var err error
+	if chain == nil {
+		err = ec.finalInterceptor(inv, nil)
+	} else {
+		err = chain.Interceptor(inv, chain.Next)
+	}
+	if err == nil && inv.resp == nil {
+		err = NewSystemError(ERROR_INTERNAL_ERROR, "response is nil")
+	}
+	return err
+}
+
+func (ec *ServiceClient) finalInterceptor(inv *Invocation, next *InterceptorInfo) error {
+	if ec.bulkhead == nil {
+		return ec.request(inv)
+	}
+	return ec.bulkhead.Call(func() error {
+		return ec.request(inv)
+	})
+}
+
+func (ec *ServiceClient) request(inv *Invocation) error {
+	if inv.target != nil {
+		return ec.requestTarget(inv)
+	}
+	var err error
+	if ec.coalescer != nil && ec.coalescer.coalesced(inv.head.GetMethod()) {
+		if key, ok := requestKey(inv.format, inv.head, inv.body); ok {
+			inv.node, inv.resp, err = ec.coalescer.do(key, func() (*Node, *EasyPackage, error) {
+				return ec.requestWithBreaker(inv.format, inv.head, inv.body, inv.timeout)
+			})
+			return err
+		}
+	}
+	inv.node, inv.resp, err = ec.requestWithBreaker(inv.format, inv.head, inv.body, inv.timeout)
+	return err
+}
+
+//send the request to the target node and wait,no load balance,retry or hedging applies
+func (ec *ServiceClient) requestTarget(inv *Invocation) error {
+	inv.node = inv.target
+	session, err := ec.sendToNode(inv.target, inv.format, inv.head, inv.body, inv.timeout)
+	if err != nil {
+		return err
+	}
+	inv.resp = <-session.respChan
+	return getPkgError(inv.resp)
+}
+
+//send the request and wait,failed attempts are retried on nodes not tried by the retry policy,
+//node is the one responding the last attempt
+func (ec *ServiceClient) requestWithRetry(format byte, head *EasyHead, body interface{}, timeout time.Duration) (*Node, *EasyPackage, error) {
+
+	var lastNode *Node
+	var respPkg *EasyPackage
+	var err error
+	tried := make(map[string]bool, 0)
+
+	for attempts := 1; ; attempts++ {
+
+		node, pickErr := ec.pick(head, tried)
+		if pickErr != nil {
+			if attempts == 1 {
+				return nil, nil, pickErr
+			}
+			//all candidates are tried
+			return lastNode, respPkg, err
+		}
+
+		lastNode, respPkg, err = ec.sendWithBreaker(node, format, head, body, timeout, tried)
+
+		if err == nil || ec.retry == nil || attempts >= ec.retry.MaxAttempts || !ec.retry.retryable(head.GetMethod(), err) {
+			return lastNode, respPkg, err
+		}
+
+		elog.Infof("retry service=%s,method=%s,attempts=%d,err=%v", head.GetService(), head.GetMethod(), attempts, err)
+		time.Sleep(ec.retry.backoff(attempts))
+	}
+}
+
+//send the request to node and wait,a hedged copy is sent to another node if no reply arrives within the hedge delay,
+//nodes sent to are added to tried
+func (ec *ServiceClient) send(node *Node, format byte, head *EasyHead, body interface{}, timeout time.Duration, tried map[string]bool) (*Node, *EasyPackage, error) {
+
+	tried[node.GetAddr()] = true
+	startTime := time.Now()
+	session, err := ec.sendToNode(node, format, head, body, timeout)
+	if err != nil {
+		return node, nil, err
+	}
+
+	method := head.GetMethod()
+	if ec.hedge == nil || !ec.hedge.hedged(method) {
+		respPkg := <-session.respChan
+		return node, respPkg, getPkgError(respPkg)
+	}
+
+	ec.hedge.deposit()
+	var respPkg *EasyPackage
+	delay := ec.hedge.delay(method)
+	if delay <= 0 || delay >= timeout {
+		respPkg = <-session.respChan
+	} else {
+		timer := time.NewTimer(delay)
+		select {
+		case respPkg = <-session.respChan:
+			timer.Stop()
+		case <-timer.C:
+			node, respPkg = ec.sendHedge(session, format, head, body, startTime.Add(timeout), tried)
+		}
+	}
+
+	err = getPkgError(respPkg)
+	if err == nil {
+		ec.hedge.observe(method, time.Since(startTime))
+	}
+	return node, respPkg, err
+}
+
+//send a hedged copy and wait for the first successful response before deadline,the other session is cancelled
+func (ec *ServiceClient) sendHedge(session *EasySession, format byte, head *EasyHead, body interface{}, deadline time.Time, tried map[string]bool) (*Node, *EasyPackage) {
+
+	if !ec.hedge.withdraw() {
+		return session.node, <-session.respChan
+	}
+	node, err := ec.pick(head, tried)
+	if err != nil {
+		return session.node, <-session.respChan
+	}
+	tried[node.GetAddr()] = true
+	hedgeSession, err := ec.sendToNode(node, format, head, body, time.Until(deadline))
+	if err != nil {
+		return session.node, <-session.respChan
+	}
+
+	var respPkg *EasyPackage
+	respChan, hedgeChan := session.respChan, hedgeSession.respChan
+	for respChan != nil || hedgeChan != nil {
+		select {
+		case respPkg = <-respChan:
+			respChan, node = nil, session.node
+		case respPkg = <-hedgeChan:
+			hedgeChan, node = nil, hedgeSession.node
+		}
+		if getPkgError(respPkg) == nil {
+			break
+		}
+	}
+	//cancelling a completed session does nothing
+	ec.sessionMgr.CancelSession(session)
+	ec.sessionMgr.CancelSession(hedgeSession)
+	return node, respPkg
+}
+
+//nodes of the service of head
+func (ec *ServiceClient) getNodes(head *EasyHead) ([]*Node, error) {
+
 	if head.GetService() != ec.serviceName {
 		return nil, NewSystemError(ERROR_INTERNAL_ERROR, "service name is different from init")
 	}
 
 	if ec.nodeMgr == nil {
-		return nil, NewSystemError(ERROR_INTERNAL_ERROR, "nodemgr is nil,maybe etcd connect fail")
+		return nil, NewSystemError(ERROR_INTERNAL_ERROR, "nodemgr is nil,maybe registry init fail")
 	}
-	lbType := ec.loadBalanceType
 
-	if head.GetRouteKey() != "" {
-		lbType = LB_HASH
+	nodeList, err := ec.nodeMgr.getNodes()
+	if err != nil {
+		return nil, NewSystemError(ERROR_SERVICE_NOT_FOUND, err.Error())
 	}
+	return nodeList, nil
+}
 
-	nodeList, err := ec.nodeMgr.getNodes()
+//pick a node for the request,nodes in excluded are skipped
+func (ec *ServiceClient) pick(head *EasyHead, excluded map[string]bool) (*Node, error) {
+
+	balancer := ec.balancer
+	if head.GetRouteKey() != "" {
+		balancer = ec.hashBalancer
+	}
+	if balancer == nil {
+		return nil, NewSystemError(ERROR_INTERNAL_ERROR, "balancer "+ec.balancerName+" not found")
+	}
 
+	nodeList, err := ec.getNodes(head)
 	if err != nil {
-		return nil, NewSystemError(ERROR_SERVICE_NOT_FOUND, err.Error())
+		return nil, err
+	}
+
+	if len(excluded) > 0 {
+		candidates := make([]*Node, 0, len(nodeList))
+		for _, node := range nodeList {
+			if !excluded[node.GetAddr()] {
+				candidates = append(candidates, node)
+			}
+		}
+		nodeList = candidates
 	}
 
-	ec.lb.SetNodes(nodeList)
-	node, err := ec.lb.GetNode(lbType, head.GetRouteKey())
+	node, err := balancer.Pick(ec.filterNodes(nodeList, head), head)
 	if err != nil {
 		return nil, NewSystemError(ERROR_INTERNAL_ERROR, err.Error())
 	}
+	return node, nil
+}
+
+//send the request to node,every request sent reports its result to outlier detector
+func (ec *ServiceClient) sendToNode(node *Node, format byte, head *EasyHead, body interface{}, timeout time.Duration) (*EasySession, error) {
+
+	//body is encoded before the node is charged,an unencodable body is not a node failure
+	bodyData, ok := body.([]byte)
+	if !ok {
+		var err error
+		bodyData, err = NewPackageWithBody(format, head, body).EncodeBody()
+		if err != nil {
+			return nil, NewSystemError(ERROR_INTERNAL_ERROR, err.Error())
+		}
+	}
+
+	if ec.outlier != nil {
+		ec.outlier.onPicked(node, timeout)
+	}
+
 	key := node.Ip + ":" + strconv.Itoa(node.Port)
 
 	ec.mutex.Lock()
@@ -152,7 +483,11 @@ func (ec *ServiceClient) RequestAsyncWithHead(format byte, head *EasyHead, body
 
 	conn, err := pool.Acquire()
 	if err != nil {
-		return nil, NewSystemError(ERROR_INTERNAL_ERROR, err.Error())
+		sysErr := NewSystemError(ERROR_CONNECTION_LOST, err.Error())
+		if ec.outlier != nil {
+			ec.outlier.report(node, sysErr)
+		}
+		return nil, sysErr
 	}
 	pool.Release(conn)
 
@@ -161,32 +496,69 @@ func (ec *ServiceClient) RequestAsyncWithHead(format byte, head *EasyHead, body
 	session := ec.sessionMgr.InitSession(timeout, node)
 	head.SetSeq(session.seq)
 
-	bodyData, ok := body.([]byte)
-	if ok {
-
-		pkgData, err := NewPackageWithBodyData(format, head, bodyData).EncodeWithBodyData()
-		if err != nil {
-			ec.sessionMgr.DestorySessionAndRespPkg(session, nil)
-			return nil, NewSystemError(ERROR_INTERNAL_ERROR, err.Error())
-		}
-		easyConn.Send(pkgData)
+	pkgData, err := NewPackageWithBodyData(format, head, bodyData).EncodeWithBodyData()
+	if err != nil {
+		ec.sessionMgr.CancelSession(session)
+		return nil, NewSystemError(ERROR_INTERNAL_ERROR, err.Error())
+	}
+	easyConn.Send(pkgData)
 
-	} else {
-		pkgData, err := NewPackageWithBody(format, head, body).EncodeWithBody()
+	return session, nil
+}
 
-		if err != nil {
-			ec.sessionMgr.DestorySessionAndRespPkg(session, nil)
-			return nil, NewSystemError(ERROR_INTERNAL_ERROR, err.Error())
-		}
-		easyConn.Send(pkgData)
+//candidates of the request
+func (ec *ServiceClient) filterNodes(nodeList []*Node, head *EasyHead) []*Node {
+	if ec.outlier != nil {
+		nodeList = ec.outlier.filter(nodeList)
+	}
+	if ec.breaker != nil {
+		nodeList = ec.breaker.filter(nodeList, ec.serviceName+"."+head.GetMethod())
 	}
+	if ec.router != nil {
+		nodeList = ec.router.Route(nodeList, head)
+	}
+	if ec.locality != nil {
+		nodeList = ec.locality.filter(nodeList)
+	}
+	return nodeList
+}
 
-	go func() {
-		<-session.timer.C
-		ec.sessionMgr.DestorySessionAndRespPkg(session, nil)
-	}()
+func (ec *ServiceClient) onNodesChanged(nodeList []*Node) {
+	for _, node := range nodeList {
+		node.warmup = ec.slowStart
+	}
+	if ec.outlier != nil {
+		ec.outlier.update(nodeList)
+	}
+	if ec.breaker != nil {
+		ec.breaker.update(nodeList)
+	}
+	if ec.balancer != nil {
+		ec.balancer.Update(nodeList)
+	}
+	ec.hashBalancer.Update(nodeList)
+}
 
-	return session.respChan, nil
+//a cancelled session is not judged by outlier detector,balancer gets its time spent as latency
+func (ec *ServiceClient) onSessionDone(node *Node, spend time.Duration, respPkg *EasyPackage, cancelled bool) {
+	if cancelled {
+		if ec.outlier != nil {
+			ec.outlier.release(node)
+		}
+		if ec.balancer != nil {
+			ec.balancer.Report(node, spend, nil)
+		}
+		ec.hashBalancer.Report(node, spend, nil)
+		return
+	}
+	err := getPkgError(respPkg)
+	if ec.outlier != nil {
+		ec.outlier.report(node, err)
+	}
+	if ec.balancer != nil {
+		ec.balancer.Report(node, spend, err)
+	}
+	ec.hashBalancer.Report(node, spend, err)
 }
 
 func (ec *ServiceClient) Process(respPkg *EasyPackage) {
@@ -12,10 +12,12 @@ import (
 
 //ServiceInfo for ServiceContext
 type ServiceInfo struct {
-	name    string
-	port    int
-	weight  int
-	service interface{}
+	name      string
+	port      int
+	weight    int
+	service   interface{}
+	meta      map[string]string
+	startTime int64
 }
 
 type MiddlewareFunc func(req *Request, resp *Response, client *EasyConnection, next *MiddlewareInfo)
@@ -28,22 +30,37 @@ type MiddlewareInfo struct {
 //ServiceContext for Easycall
 type ServiceContext struct {
 	serviceList map[string]*ServiceInfo
-	endpoints   []string
+	registry    Registry
 	middlewares map[string][]*MiddlewareInfo
 }
 
 //endpoints etcd endpoints list
 func NewServiceContext(endpoints []string) *ServiceContext {
 
-	return &ServiceContext{make(map[string]*ServiceInfo, 0), endpoints, make(map[string][]*MiddlewareInfo, 0)}
+	registry, err := NewEtcdRegistry(endpoints, time.Second*ETCD_CONNECT_TIMEOUT)
+	if err != nil {
+		elog.Error("init registry fail:", err)
+		return NewServiceContextWithRegistry(nil)
+	}
+	return NewServiceContextWithRegistry(registry)
+}
+
+//registry where microservices are registered
+func NewServiceContextWithRegistry(registry Registry) *ServiceContext {
+
+	return &ServiceContext{serviceList: make(map[string]*ServiceInfo, 0), registry: registry, middlewares: make(map[string][]*MiddlewareInfo, 0)}
 }
 
 //name microservice name
 //port microservice port
 //service microservice implement
 //weight microservice weight for loadbalance
-func (svc *ServiceContext) CreateService(name string, port int, service interface{}, weight int) error {
-	info := &ServiceInfo{name, port, weight, service}
+//opts service options like metadata registered with the service
+func (svc *ServiceContext) CreateService(name string, port int, service interface{}, weight int, opts ...ServiceOption) error {
+	info := &ServiceInfo{name, port, weight, service, make(map[string]string, 0), 0}
+	for _, opt := range opts {
+		opt(info)
+	}
 	svc.serviceList[name] = info
 	return nil
 }
@@ -76,12 +93,11 @@ func (svc *ServiceContext) StartAndWait() error {
 			switch s {
 			case syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT:
 				for _, info := range svc.serviceList {
-					elog.Infof("unregister service %s,port=%d", info.name, info.port)
-					register, err := NewServiceRegister(svc.endpoints, time.Second*ETCD_CONNECT_TIMEOUT)
-					if err != nil {
-						continue
+					if svc.registry == nil {
+						break
 					}
-					register.Unregister(info.name, info.port)
+					elog.Infof("unregister service %s,port=%d", info.name, info.port)
+					svc.registry.Deregister(info.name, svc.getNode(info))
 				}
 				os.Exit(0)
 			default:
@@ -104,13 +120,13 @@ func (svc *ServiceContext) StartAndWait() error {
 				wg.Done()
 				return
 			}
-			register, err := NewServiceRegister(svc.endpoints, time.Second*ETCD_CONNECT_TIMEOUT)
-			if err != nil {
+			info.startTime = GetTimeNow()
+			if svc.registry == nil {
 				wg.Done()
-				elog.Error("init register fail:", err, info.name, info.port, info.weight)
+				elog.Error("registry is nil,maybe init fail", info.name, info.port, info.weight)
 				return
 			}
-			err = register.Register(info.name, info.port, info.weight)
+			err = svc.registry.Register(info.name, svc.getNode(info))
 			if err != nil {
 				wg.Done()
 				elog.Error("register fail:", err, info.name, info.port, info.weight)
@@ -124,3 +140,7 @@ func (svc *ServiceContext) StartAndWait() error {
 
 	return nil
 }
+
+func (svc *ServiceContext) getNode(info *ServiceInfo) *Node {
+	return &Node{Ip: GetLocalIp(), Port: info.port, Weight: info.weight, Meta: info.meta, StartTime: info.startTime}
+}
@@ -64,9 +64,30 @@ func (h *ServiceHandler) Dispatch(pkgData []byte, client *EasyConnection) {
 
 	if err != nil {
 		elog.Error("submit to pool fail,", err)
+		h.onBusy(pkgData, client)
 	}
 }
 
+//tell the client the request is not processed,so it can be retried on other nodes
+func (h *ServiceHandler) onBusy(pkgData []byte, client *EasyConnection) {
+
+	reqPkg, err := DecodeWithBodyData(pkgData)
+	if err != nil {
+		elog.Error("decode pkg fail:", err)
+		return
+	}
+	head := reqPkg.GetHead()
+	head.SetRet(ERROR_SERVICE_BUSY)
+	head.SetMsg("service " + head.GetService() + " is busy")
+	respPkg := NewPackageWithBody(reqPkg.GetFormat(), head, make(map[string]interface{}))
+	respData, err := respPkg.EncodeWithBody()
+	if err != nil {
+		elog.Error("encode pkg fail:", err)
+		return
+	}
+	client.Send(respData)
+}
+
 func (h *ServiceHandler) onRequest(req *Request, resp *Response, client *EasyConnection) {
 
 	m := h.value.MethodByName(req.head.Method)
@@ -0,0 +1,26 @@
+package easycall
+
+import "strings"
+
+//ServiceOption configures a service created by ServiceContext.CreateService
+type ServiceOption func(info *ServiceInfo)
+
+//register metadata key=value with the service,clients read it from Node.Meta
+func WithServiceMeta(key string, value string) ServiceOption {
+	return func(info *ServiceInfo) {
+		info.meta[key] = value
+	}
+}
+
+func WithServiceVersion(version string) ServiceOption {
+	return WithServiceMeta(META_VERSION, version)
+}
+
+func WithServiceZone(zone string) ServiceOption {
+	return WithServiceMeta(META_ZONE, zone)
+}
+
+//tags like canary
+func WithServiceTags(tags ...string) ServiceOption {
+	return WithServiceMeta(META_TAGS, strings.Join(tags, ","))
+}
@@ -7,18 +7,24 @@ import (
 )
 
 type EasySession struct {
-	seqOrgi  uint64
-	seq      uint64
-	respChan chan *EasyPackage
-	timer    *time.Timer
-	mutex    *sync.Mutex
-	node     *Node
+	seqOrgi   uint64
+	seq       uint64
+	respChan  chan *EasyPackage //buffered,so completing a session never blocks
+	timer     *time.Timer
+	mutex     *sync.Mutex
+	node      *Node
+	startTime time.Time
+	done      bool
 }
 
+//called once a session completes,respPkg is nil when the session timed out or was cancelled
+type SessionDoneFunc func(node *Node, spend time.Duration, respPkg *EasyPackage, cancelled bool)
+
 type EasySessionManager struct {
 	sessionMap map[uint64]*EasySession
 	mutex      *sync.RWMutex
 	seq        uint64
+	onDone     SessionDoneFunc
 }
 
 func (esm *EasySessionManager) AddSession(sessionId uint64, session *EasySession) {
@@ -45,7 +51,14 @@ func (esm *EasySessionManager) InitSession(timeout time.Duration, node *Node) *E
 	seq := atomic.AddUint64(&esm.seq, 1)
 	atomic.AddInt32(&node.Active, 1)
 
-	session := &EasySession{0, seq, make(chan *EasyPackage), time.NewTimer(timeout), &sync.Mutex{}, node}
+	session := &EasySession{0, seq, make(chan *EasyPackage, 1), nil, &sync.Mutex{}, node, time.Now(), false}
+
+	//session completes with nil respPkg when it times out
+	session.mutex.Lock()
+	session.timer = time.AfterFunc(timeout, func() {
+		esm.DestorySessionAndRespPkg(session, nil)
+	})
+	session.mutex.Unlock()
 
 	esm.mutex.Lock()
 	esm.sessionMap[seq] = session
@@ -64,10 +77,13 @@ func (esm *EasySessionManager) DestorySessionAndRespPkg(session *EasySession, re
 	esm.mutex.Unlock()
 
 	session.mutex.Lock()
-	if session.respChan != nil {
+	if !session.done {
+		if esm.onDone != nil {
+			esm.onDone(session.node, time.Since(session.startTime), respPkg, false)
+		}
 		session.respChan <- respPkg
 		close(session.respChan)
-		session.respChan = nil
+		session.done = true
 		atomic.AddInt32(&session.node.Active, -1)
 	}
 	if session.timer != nil {
@@ -76,3 +92,29 @@ func (esm *EasySessionManager) DestorySessionAndRespPkg(session *EasySession, re
 	session.mutex.Unlock()
 
 }
+
+//cancel a session nobody waits for,its response is dropped and time spent so far is reported
+func (esm *EasySessionManager) CancelSession(session *EasySession) {
+
+	if session == nil {
+		return
+	}
+
+	esm.mutex.Lock()
+	delete(esm.sessionMap, session.seq)
+	esm.mutex.Unlock()
+
+	session.mutex.Lock()
+	if !session.done {
+		if esm.onDone != nil {
+			esm.onDone(session.node, time.Since(session.startTime), nil, true)
+		}
+		close(session.respChan)
+		session.done = true
+		atomic.AddInt32(&session.node.Active, -1)
+	}
+	if session.timer != nil {
+		session.timer.Stop()
+	}
+	session.mutex.Unlock()
+}
@@ -0,0 +1,64 @@
+package easycall
+
+import (
+	"sync"
+)
+
+//StaticRegistry keeps a fixed set of service addresses in memory,no etcd needed
+type StaticRegistry struct {
+	mutex    *sync.Mutex
+	services map[string][]*Node
+	watchers map[string][]WatchFunc
+}
+
+//services node list of every service, keyed by service name
+func NewStaticRegistry(services map[string][]*Node) *StaticRegistry {
+	registry := &StaticRegistry{}
+	registry.mutex = &sync.Mutex{}
+	registry.services = make(map[string][]*Node, 0)
+	registry.watchers = make(map[string][]WatchFunc, 0)
+	for name, nodeList := range services {
+		registry.services[name] = copyNodes(nodeList)
+	}
+	return registry
+}
+
+func (sr *StaticRegistry) Register(name string, node *Node) error {
+	sr.mutex.Lock()
+	sr.services[name] = upsertNode(sr.services[name], node)
+	sr.mutex.Unlock()
+	sr.notify(name)
+	return nil
+}
+
+func (sr *StaticRegistry) Deregister(name string, node *Node) error {
+	sr.mutex.Lock()
+	sr.services[name] = removeNode(sr.services[name], node)
+	sr.mutex.Unlock()
+	sr.notify(name)
+	return nil
+}
+
+func (sr *StaticRegistry) List(name string) ([]*Node, error) {
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+	return copyNodes(sr.services[name]), nil
+}
+
+func (sr *StaticRegistry) Watch(name string, watcher WatchFunc) error {
+	sr.mutex.Lock()
+	sr.watchers[name] = append(sr.watchers[name], watcher)
+	sr.mutex.Unlock()
+	return nil
+}
+
+func (sr *StaticRegistry) notify(name string) {
+	sr.mutex.Lock()
+	watchers := sr.watchers[name]
+	sr.mutex.Unlock()
+
+	for _, watcher := range watchers {
+		nodeList, _ := sr.List(name)
+		watcher(nodeList)
+	}
+}
@@ -15,6 +15,7 @@ import (
 const (
 	EASYCALL_ETCD_SERVICE_PATH     = "/easycall/services"
 	EASYCALL_ETCD_CONFIG_PATH      = "/easycall/configs"
+	EASYCALL_ETCD_ROUTE_PATH       = "/easycall/routes"
 	EASYCALL_CONFIG_PATH           = "conf"
 	EASYCALL_CONFIG_CHECK_INTERVAL = 60
 	EASYCALL_SERVICE_GO_POOL_SIZE  = 10000